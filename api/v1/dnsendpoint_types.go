@@ -0,0 +1,117 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProviderReference selects the DNS provider records are written with: a DNSProvider in
+// the same namespace, a ClusterDNSProvider, or like the dns.configuration/type and
+// dns.configuration/source annotations of an Ingress a type and a ConfigMap or Secret.
+// +kubebuilder:validation:XValidation:rule="has(self.kind) ? has(self.name) : has(self.type) && has(self.source)",message="either kind and name or type and source must be set"
+type ProviderReference struct {
+	// Kind is DNSProvider or ClusterDNSProvider.
+	// +kubebuilder:validation:Enum=DNSProvider;ClusterDNSProvider
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Name of the DNSProvider or ClusterDNSProvider.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Type is the provider type.
+	// +kubebuilder:validation:Enum=cloudflare;bind
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Source is the name of the ConfigMap or Secret with the provider configuration, or
+	// namespace/name for one in a shared namespace.
+	// +optional
+	Source string `json:"source,omitempty"`
+}
+
+// ProviderSpecificProperty is a setting only some providers understand.
+type ProviderSpecificProperty struct {
+	// Name of the setting, e.g. proxied for Cloudflare.
+	Name string `json:"name"`
+	// Value of the setting.
+	Value string `json:"value"`
+}
+
+// DNSEndpointSpec defines the desired state of DNSEndpoint.
+type DNSEndpointSpec struct {
+	// Hostname is the fully qualified name of the records.
+	// +kubebuilder:validation:MinLength=1
+	Hostname string `json:"hostname"`
+	// RecordType is the type of the records. It defaults to A or AAAA depending on the targets.
+	// +kubebuilder:validation:Enum=A;AAAA
+	// +optional
+	RecordType string `json:"recordType,omitempty"`
+	// Targets are the addresses the hostname resolves to.
+	// +kubebuilder:validation:MinItems=1
+	Targets []string `json:"targets"`
+	// TTL of the records in seconds. The provider default is used if unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TTL int64 `json:"ttl,omitempty"`
+	// ProviderRef selects the DNS provider.
+	ProviderRef ProviderReference `json:"providerRef"`
+	// ProviderSpecific are settings only some providers understand.
+	// +optional
+	ProviderSpecific []ProviderSpecificProperty `json:"providerSpecific,omitempty"`
+}
+
+// DNSEndpointStatus defines the observed state of DNSEndpoint.
+type DNSEndpointStatus struct {
+	// ObservedGeneration is the generation that was last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the records. Ready is true when they are published.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Hostname",type=string,JSONPath=`.spec.hostname`
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.recordType`
+// +kubebuilder:printcolumn:name="Targets",type=string,JSONPath=`.spec.targets`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DNSEndpoint is the Schema for the dnsendpoints API. It requests DNS records for
+// workloads that are not exposed through an Ingress.
+type DNSEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSEndpointSpec   `json:"spec,omitempty"`
+	Status DNSEndpointStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSEndpointList contains a list of DNSEndpoint.
+type DNSEndpointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSEndpoint `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSEndpoint{}, &DNSEndpointList{})
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceReference names a Service.
+type ServiceReference struct {
+	// Name of the Service.
+	Name string `json:"name"`
+	// Namespace of the Service.
+	Namespace string `json:"namespace"`
+}
+
+// SafetyLimits protect against mass changes caused by a misconfiguration.
+type SafetyLimits struct {
+	// MaxHostsPerSource is the number of hostnames published for one Ingress. Further
+	// hostnames fail until the limit is raised. Unlimited if unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxHostsPerSource int32 `json:"maxHostsPerSource,omitempty"`
+	// MaxDeletionsPerReconcile is the number of hostnames whose records are removed in one
+	// reconcile. Further removals are postponed and retried. Unlimited if unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxDeletionsPerReconcile int32 `json:"maxDeletionsPerReconcile,omitempty"`
+}
+
+// HostnameTemplates generate hostnames for Ingresses and Services that declare none. The
+// templates are Go templates executed with .Name, .Namespace, .Kind, .Labels and
+// .Annotations of the object, e.g. {{.Name}}.{{.Namespace}}.apps.example.com.
+type HostnameTemplates struct {
+	// Default is the template of namespaces without one of their own.
+	// +optional
+	Default string `json:"default,omitempty"`
+	// Namespaces maps namespaces to their template. An empty template turns generated
+	// hostnames off in the namespace.
+	// +optional
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+}
+
+// NodeTargets selects the nodes whose addresses the records of Ingresses point to.
+type NodeTargets struct {
+	// Selector selects the nodes. All nodes are used if unset.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// AddressType is the type of the node addresses that are published.
+	// +kubebuilder:validation:Enum=ExternalIP;InternalIP
+	// +kubebuilder:default=ExternalIP
+	// +optional
+	AddressType string `json:"addressType,omitempty"`
+}
+
+// DNSManagerConfigSpec defines the desired state of DNSManagerConfig.
+// +kubebuilder:validation:XValidation:rule="!has(self.defaultProvider) || !has(self.defaultProvider.kind) || self.defaultProvider.kind == 'ClusterDNSProvider'",message="the default provider cannot be a namespaced DNSProvider"
+type DNSManagerConfigSpec struct {
+	// TargetServices are the Services whose LoadBalancer address the records of Ingresses
+	// point to. The first one with an address is used. Defaults to kube-system/traefik.
+	// +optional
+	TargetServices []ServiceReference `json:"targetServices,omitempty"`
+	// TargetNodes makes the records of Ingresses point to the addresses of the Ready nodes
+	// instead, for ingress controllers that run on the host network of the nodes.
+	// +optional
+	TargetNodes *NodeTargets `json:"targetNodes,omitempty"`
+	// ExcludeDomains are hostnames that are never published. An entry starting with "*."
+	// excludes all subdomains of the rest, e.g. *.internal.example.com.
+	// +optional
+	ExcludeDomains []string `json:"excludeDomains,omitempty"`
+	// ExcludePatterns are regular expressions; hostnames matching one are never published.
+	// +optional
+	ExcludePatterns []string `json:"excludePatterns,omitempty"`
+	// IncludeDomains limits publishing to these domains and their subdomains. An entry
+	// starting with "*." only includes the subdomains. All hostnames are published if
+	// neither includeDomains nor includePatterns is set.
+	// +optional
+	IncludeDomains []string `json:"includeDomains,omitempty"`
+	// IncludePatterns are regular expressions; hostnames matching one are published
+	// unless they are excluded.
+	// +optional
+	IncludePatterns []string `json:"includePatterns,omitempty"`
+	// IncludeTLSHosts also publishes the hostnames of spec.tls of Ingresses that no rule
+	// declares.
+	// +optional
+	IncludeTLSHosts bool `json:"includeTLSHosts,omitempty"`
+	// HostnameTemplates generate the hostnames of Ingresses and Services that declare none.
+	// +optional
+	HostnameTemplates *HostnameTemplates `json:"hostnameTemplates,omitempty"`
+	// DeletionPolicy is what happens to the records of a deleted Ingress without a
+	// dns.configuration/deletion-policy annotation.
+	// +kubebuilder:validation:Enum=delete;retain
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// DefaultProvider is used for Ingresses without provider annotations. Without it
+	// such Ingresses are ignored.
+	// +optional
+	DefaultProvider *ProviderReference `json:"defaultProvider,omitempty"`
+	// ResyncInterval is how often published records are checked again. Records are only
+	// checked when their source changes if unset.
+	// +optional
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty"`
+	// OwnerID identifies this installation in the ownership TXT records, so several
+	// installations can share a zone. Records written with another owner ID are left alone.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	OwnerID string `json:"ownerID,omitempty"`
+	// NamespaceLocalSources makes dns.configuration/source names refer to a ConfigMap or
+	// Secret in the namespace of the Ingress or DNSEndpoint instead of this namespace. Sources
+	// in this namespace are then selected with namespace/name.
+	// +optional
+	NamespaceLocalSources bool `json:"namespaceLocalSources,omitempty"`
+	// SharedSourceNamespaces are further namespaces whose ConfigMaps and Secrets every
+	// namespace may select as namespace/name.
+	// +optional
+	SharedSourceNamespaces []string `json:"sharedSourceNamespaces,omitempty"`
+	// Limits protect against mass changes caused by a misconfiguration.
+	// +optional
+	Limits SafetyLimits `json:"limits,omitempty"`
+}
+
+// DNSManagerConfigStatus defines the observed state of DNSManagerConfig.
+type DNSManagerConfigStatus struct {
+	// ObservedGeneration is the generation that was last validated.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the configuration. Ready is true when it is valid
+	// and in use.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DNSManagerConfig is the Schema for the dnsmanagerconfigs API. The operator reads the one
+// named by CONFIG_MAP_NAME in CONFIG_MAP_NAMESPACE.
+type DNSManagerConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSManagerConfigSpec   `json:"spec,omitempty"`
+	Status DNSManagerConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSManagerConfigList contains a list of DNSManagerConfig.
+type DNSManagerConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSManagerConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSManagerConfig{}, &DNSManagerConfigList{})
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KindDNSProvider is the kind of a namespaced provider configuration.
+	KindDNSProvider = "DNSProvider"
+	// KindClusterDNSProvider is the kind of a cluster-wide provider configuration.
+	KindClusterDNSProvider = "ClusterDNSProvider"
+)
+
+// SecretKeySelector selects a key of a Secret.
+type SecretKeySelector struct {
+	// Name of the Secret.
+	Name string `json:"name"`
+	// Namespace of the Secret. Only a ClusterDNSProvider may set it; it defaults to
+	// the namespace of the operator configuration. A DNSProvider always uses its own namespace.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Key of the value in the Secret.
+	Key string `json:"key"`
+}
+
+// CloudflareProviderSpec configures the Cloudflare API.
+type CloudflareProviderSpec struct {
+	// ZoneID is the ID of the Cloudflare zone.
+	// +kubebuilder:validation:MinLength=1
+	ZoneID string `json:"zoneID"`
+	// APITokenSecretRef selects the API token.
+	APITokenSecretRef SecretKeySelector `json:"apiTokenSecretRef"`
+	// Proxied routes A, AAAA and CNAME records through Cloudflare by default.
+	// +optional
+	Proxied bool `json:"proxied,omitempty"`
+}
+
+// RFC2136ProviderSpec configures dynamic updates signed with TSIG, e.g. for BIND.
+type RFC2136ProviderSpec struct {
+	// Server is the hostname or address of the DNS server.
+	// +kubebuilder:validation:MinLength=1
+	Server string `json:"server"`
+	// Port of the DNS server, 53 if unset.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Zone is the zone the records are written to.
+	// +kubebuilder:validation:MinLength=1
+	Zone string `json:"zone"`
+	// TSIGKeyName is the name of the TSIG key, kube-dns-manager if unset.
+	// +optional
+	TSIGKeyName string `json:"tsigKeyName,omitempty"`
+	// TSIGSecretRef selects the HMAC-SHA512 secret of the TSIG key.
+	TSIGSecretRef SecretKeySelector `json:"tsigSecretRef"`
+}
+
+// DNSProviderSpec defines the desired state of DNSProvider and ClusterDNSProvider.
+// +kubebuilder:validation:XValidation:rule="has(self.cloudflare) != has(self.rfc2136)",message="exactly one of cloudflare or rfc2136 must be set"
+type DNSProviderSpec struct {
+	// Cloudflare configures the Cloudflare API.
+	// +optional
+	Cloudflare *CloudflareProviderSpec `json:"cloudflare,omitempty"`
+	// RFC2136 configures dynamic updates, e.g. for BIND.
+	// +optional
+	RFC2136 *RFC2136ProviderSpec `json:"rfc2136,omitempty"`
+	// Zones limits the hostnames the provider writes records for to these domains and
+	// their subdomains. All hostnames are allowed if empty.
+	// +optional
+	Zones []string `json:"zones,omitempty"`
+	// TTL of the records in seconds. The provider default is used if unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// DNSProviderStatus defines the observed state of DNSProvider and ClusterDNSProvider.
+type DNSProviderStatus struct {
+	// ObservedGeneration is the generation that was last validated.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the provider. Ready is true when the
+	// credentials were accepted by the provider.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DNSProvider is the Schema for the dnsproviders API. It configures a DNS provider for
+// the Ingresses and DNSEndpoints of its namespace.
+type DNSProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSProviderSpec   `json:"spec,omitempty"`
+	Status DNSProviderStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSProviderList contains a list of DNSProvider.
+type DNSProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSProvider `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterDNSProvider is the Schema for the clusterdnsproviders API. It configures a DNS
+// provider for Ingresses and DNSEndpoints in all namespaces.
+type ClusterDNSProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSProviderSpec   `json:"spec,omitempty"`
+	Status DNSProviderStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterDNSProviderList contains a list of ClusterDNSProvider.
+type ClusterDNSProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterDNSProvider `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSProvider{}, &DNSProviderList{}, &ClusterDNSProvider{}, &ClusterDNSProviderList{})
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SourceReference identifies the object a DNSRecordSet belongs to. The object lives
+// in the same namespace as the DNSRecordSet.
+type SourceReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// DNSRecordSetSpec defines the desired state of DNSRecordSet.
+type DNSRecordSetSpec struct {
+	// SourceRef is the object whose hostnames the records are published for.
+	SourceRef SourceReference `json:"sourceRef"`
+}
+
+// ManagedRecord is a DNS record written by kube-dns-manager.
+type ManagedRecord struct {
+	// Host is the fully qualified hostname of the record.
+	Host string `json:"host"`
+	// Type is the record type, e.g. A or AAAA.
+	Type string `json:"type"`
+	// Target is the content the record points to.
+	Target string `json:"target"`
+	// Provider is the dns.configuration/type the record was written with.
+	Provider string `json:"provider"`
+	// Source is the dns.configuration/source the provider was configured from, or the
+	// name of the DNSProvider or ClusterDNSProvider if ProviderKind is set.
+	Source string `json:"source"`
+	// ProviderKind is DNSProvider or ClusterDNSProvider for records written with one.
+	// +optional
+	ProviderKind string `json:"providerKind,omitempty"`
+	// Zone is the provider zone the record lives in.
+	// +optional
+	Zone string `json:"zone,omitempty"`
+	// RecordIDs are the provider IDs of the record and its ownership TXT record, if the provider has IDs.
+	// +optional
+	RecordIDs []string `json:"recordIDs,omitempty"`
+}
+
+// HostConflict is a hostname the source declares but another object publishes.
+type HostConflict struct {
+	// Host is the conflicting hostname.
+	Host string `json:"host"`
+	// Owner is the namespace/name of the object that publishes the hostname.
+	Owner string `json:"owner"`
+	// Kind of the owner, Ingress if empty.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// HostFailure is a hostname whose records could not be written or removed.
+type HostFailure struct {
+	// Host is the hostname that failed.
+	Host string `json:"host"`
+	// Message is the error of the last attempt.
+	Message string `json:"message"`
+	// Permanent is set when retrying will not help until the configuration changes.
+	// +optional
+	Permanent bool `json:"permanent,omitempty"`
+	// Attempts is the number of consecutive failed attempts.
+	Attempts int32 `json:"attempts"`
+	// Provider is the provider the failure is for, if the source publishes with several.
+	// +optional
+	Provider string `json:"provider,omitempty"`
+}
+
+// HostState is the publishing state of a hostname.
+// +kubebuilder:validation:Enum=Published;Failed;Conflict;Excluded
+type HostState string
+
+const (
+	// HostStatePublished means the records of the hostname are up to date.
+	HostStatePublished HostState = "Published"
+	// HostStateFailed means the last attempt to write or remove the records failed.
+	HostStateFailed HostState = "Failed"
+	// HostStateConflict means another object publishes the hostname.
+	HostStateConflict HostState = "Conflict"
+	// HostStateExcluded means the hostname is on the exclude list.
+	HostStateExcluded HostState = "Excluded"
+)
+
+// ConditionReady is true when every hostname of the source that is not excluded is published.
+const ConditionReady = "Ready"
+
+// HostStatus summarizes the state of one hostname of the source.
+type HostStatus struct {
+	// Host is the hostname.
+	Host string `json:"host"`
+	// State is the publishing state of the hostname.
+	State HostState `json:"state"`
+	// Target is the last target written for the hostname.
+	// +optional
+	Target string `json:"target,omitempty"`
+	// Provider is the dns.configuration/type the records were written with.
+	// +optional
+	Provider string `json:"provider,omitempty"`
+	// Message explains the state, e.g. the last error.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DNSRecordSetStatus defines the observed state of DNSRecordSet.
+type DNSRecordSetStatus struct {
+	// ObservedGeneration is the generation of the source that was last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Hosts is the state of every hostname of the source.
+	// +optional
+	Hosts []HostStatus `json:"hosts,omitempty"`
+	// Conditions describe the state of the record set as a whole.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Records are the DNS records currently managed for the source.
+	// +optional
+	Records []ManagedRecord `json:"records,omitempty"`
+	// Conflicts are the hostnames that are not published because another object owns them.
+	// +optional
+	Conflicts []HostConflict `json:"conflicts,omitempty"`
+	// Failures are the hostnames whose last reconcile failed. They are retried with backoff.
+	// +optional
+	Failures []HostFailure `json:"failures,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=dnsrs
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.sourceRef.name`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DNSRecordSet is the Schema for the dnsrecordsets API. It records which DNS records
+// kube-dns-manager has written for an object, so they can be updated and removed reliably.
+type DNSRecordSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSRecordSetSpec   `json:"spec,omitempty"`
+	Status DNSRecordSetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSRecordSetList contains a list of DNSRecordSet.
+type DNSRecordSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSRecordSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSRecordSet{}, &DNSRecordSetList{})
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DNSZonePolicySpec defines which providers and domains the selected namespaces may publish with.
+// +kubebuilder:validation:XValidation:rule="has(self.namespaces) || has(self.namespaceSelector)",message="namespaces or namespaceSelector must be set"
+type DNSZonePolicySpec struct {
+	// Namespaces the policy applies to.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects further namespaces by their labels. An empty selector
+	// selects all namespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Providers the namespaces may publish with. All providers if empty.
+	// +optional
+	Providers []ProviderReference `json:"providers,omitempty"`
+	// Domains the namespaces may publish, together with their subdomains. All domains if empty.
+	// +optional
+	Domains []string `json:"domains,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DNSZonePolicy is the Schema for the dnszonepolicies API. Namespaces selected by at least
+// one policy may only publish hostnames a selecting policy allows with a provider the same
+// policy allows. Namespaces selected by no policy are not restricted.
+type DNSZonePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DNSZonePolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSZonePolicyList contains a list of DNSZonePolicy.
+type DNSZonePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSZonePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSZonePolicy{}, &DNSZonePolicyList{})
+}
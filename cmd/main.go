@@ -34,9 +34,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
 	"github.com/ruedigerp/kube-dns-manager/internal/controller"
+	webhookv1 "github.com/ruedigerp/kube-dns-manager/internal/webhook/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,6 +51,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(networkingv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1.Install(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -109,6 +112,7 @@ func main() {
 	scheme := runtime.NewScheme()
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(networkingv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1.Install(scheme))
 
 	// Metrics endpoint is enabled in 'config/default/kustomization.yaml'. The Metrics options configure the server.
 	// More info:
@@ -187,15 +191,107 @@ func main() {
 		configMapNamespace = "default" // Standardwert
 	}
 
+	// Ingresses to manage, all if unset
+	ingressScope, err := controller.ParseIngressScope(os.Getenv("INGRESS_CLASSES"), os.Getenv("WATCH_NAMESPACES"), os.Getenv("INGRESS_SELECTOR"))
+	if err != nil {
+		setupLog.Error(err, "invalid Ingress scope")
+		os.Exit(1)
+	}
+
 	if err := (&controller.IngressReconciler{
 		Client:             mgr.GetClient(),
 		Scheme:             mgr.GetScheme(),
 		ConfigMapName:      configMapName,
 		ConfigMapNamespace: configMapNamespace,
+		Recorder:           mgr.GetEventRecorder("kube-dns-manager"),
+		Scope:              ingressScope,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Ingress")
 		os.Exit(1)
 	}
+	if err := (&controller.DNSEndpointReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		ConfigMapName:      configMapName,
+		ConfigMapNamespace: configMapNamespace,
+		Recorder:           mgr.GetEventRecorder("kube-dns-manager"),
+		Scope:              ingressScope,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DNSEndpoint")
+		os.Exit(1)
+	}
+	if err := (&controller.GatewayRouteReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		ConfigMapName:      configMapName,
+		ConfigMapNamespace: configMapNamespace,
+		Recorder:           mgr.GetEventRecorder("kube-dns-manager"),
+		Scope:              ingressScope,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GatewayRoute")
+		os.Exit(1)
+	}
+	if err := (&controller.TraefikIngressRouteReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		ConfigMapName:      configMapName,
+		ConfigMapNamespace: configMapNamespace,
+		Recorder:           mgr.GetEventRecorder("kube-dns-manager"),
+		Scope:              ingressScope,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TraefikIngressRoute")
+		os.Exit(1)
+	}
+	if err := (&controller.ServiceReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		ConfigMapName:      configMapName,
+		ConfigMapNamespace: configMapNamespace,
+		Recorder:           mgr.GetEventRecorder("kube-dns-manager"),
+		Scope:              ingressScope,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Service")
+		os.Exit(1)
+	}
+	if err := (&controller.DNSProviderReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		ConfigMapName:      configMapName,
+		ConfigMapNamespace: configMapNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DNSProvider")
+		os.Exit(1)
+	}
+	if err := (&controller.ClusterDNSProviderReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		ConfigMapName:      configMapName,
+		ConfigMapNamespace: configMapNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterDNSProvider")
+		os.Exit(1)
+	}
+	if err := (&controller.DNSManagerConfigReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		ConfigMapName:      configMapName,
+		ConfigMapNamespace: configMapNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DNSManagerConfig")
+		os.Exit(1)
+	}
+	// The webhook needs a serving certificate, so it is only served if enabled
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err := webhookv1.SetupIngressWebhookWithManager(mgr, &controller.IngressValidator{
+			Client:             mgr.GetClient(),
+			ConfigMapName:      configMapName,
+			ConfigMapNamespace: configMapNamespace,
+			Scope:              ingressScope,
+		}); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Ingress")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -2,97 +2,151 @@ package dnsapi
 
 import (
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-func BindInsertRecord(server string, keyName string, keySecret string, zone string, recordName string, ipAddress string, rtype string) {
+func BindInsertRecord(server string, keyName string, keySecret string, zone string, recordName string, ipAddress string, rtype string, ttl uint32) error {
 
 	msg := new(dns.Msg)
-	msg.SetUpdate(zone + ".")
+	msg.SetUpdate(dns.Fqdn(zone))
 
-	rr, err := dns.NewRR(fmt.Sprintf("%s. 3600 IN %s %s", recordName, rtype, ipAddress))
+	rr, err := bindRR(recordName, rtype, ipAddress, ttl)
 	if err != nil {
-		log.Fatalf("Fehler beim Erstellen des Records: %v", err)
+		return fmt.Errorf("failed to create record: %w", err)
 	}
 
 	msg.Insert([]dns.RR{rr})
-	msg.SetTsig(keyName, dns.HmacSHA512, 300, time.Now().Unix())
-	client := new(dns.Client)
-	client.TsigSecret = map[string]string{keyName: keySecret}
 
-	resp, _, err := client.Exchange(msg, server)
-	if err != nil {
-		log.Fatalf("Fehler bei DNS-Update: %v", err)
-	}
+	return bindExchange(msg, server, keyName, keySecret)
 
-	if resp.Rcode != dns.RcodeSuccess {
-		log.Fatalf("DNS-Update fehlgeschlagen: %v", dns.RcodeToString[resp.Rcode])
+}
+
+func BindDeleteRecord(server string, keyName string, keySecret string, zone string, recordName string, ipAddress string, rtype string) error {
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone))
+
+	rr, err := bindRR(recordName, rtype, ipAddress, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create record: %w", err)
 	}
 
-	fmt.Println("DNS-Update erfolgreich!")
+	msg.Remove([]dns.RR{rr})
 
+	return bindExchange(msg, server, keyName, keySecret)
 }
 
-func BindDeleteRecord(server string, keyName string, keySecret string, zone string, recordName string, ipAddress string, rtype string) {
+func BindUpdateRecord(server string, keyName string, keySecret string, zone string, recordName string, newIPAddress string, oldIPAddress string, rtype string, ttl uint32) error {
 
 	msg := new(dns.Msg)
-	msg.SetUpdate(zone + ".")
+	msg.SetUpdate(dns.Fqdn(zone))
 
-	rr, err := dns.NewRR(fmt.Sprintf("%s. 3600 IN %s %s", recordName, rtype, ipAddress))
+	oldRR, err := bindRR(recordName, rtype, oldIPAddress, 0)
 	if err != nil {
-		log.Fatalf("Fehler beim Erstellen des Records: %v", err)
+		return fmt.Errorf("failed to create old record: %w", err)
 	}
 
-	msg.Remove([]dns.RR{rr})
-	msg.SetTsig(keyName, dns.HmacSHA512, 300, time.Now().Unix())
-	client := new(dns.Client)
-	client.TsigSecret = map[string]string{keyName: keySecret}
+	msg.Remove([]dns.RR{oldRR})
+
+	newRR, err := bindRR(recordName, rtype, newIPAddress, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to create new record: %w", err)
+	}
+
+	msg.Insert([]dns.RR{newRR})
+
+	return bindExchange(msg, server, keyName, keySecret)
+}
+
+// BindGetRecords queries the server directly for the records of a name.
+func BindGetRecords(server string, recordName string, rtype string) ([]Record, error) {
+
+	qtype, ok := dns.StringToType[strings.ToUpper(rtype)]
+	if !ok {
+		return nil, fmt.Errorf("unknown record type %s", rtype)
+	}
 
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(recordName), qtype)
+
+	client := new(dns.Client)
 	resp, _, err := client.Exchange(msg, server)
 	if err != nil {
-		log.Fatalf("Fehler bei DNS-Update: %v", err)
+		return nil, fmt.Errorf("DNS query failed: %w", err)
 	}
 
-	if resp.Rcode != dns.RcodeSuccess {
-		log.Fatalf("DNS-Update fehlgeschlagen: %v", dns.RcodeToString[resp.Rcode])
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, bindError(resp.Rcode)
+	}
+
+	// Answers for other names, e.g. the targets of a CNAME chain, are not records of recordName
+	var records []Record
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype != qtype || !strings.EqualFold(rr.Header().Name, dns.Fqdn(recordName)) {
+			continue
+		}
+		records = append(records, Record{
+			Type:    dns.TypeToString[qtype],
+			Name:    strings.TrimSuffix(rr.Header().Name, "."),
+			Content: bindContent(rr),
+		})
 	}
 
-	fmt.Println("DNS-Eintrag erfolgreich gelöscht!")
+	return records, nil
 }
 
-func BindUpdateRecord(server string, keyName string, keySecret string, zone string, recordName string, newIPAddress string, oldIPAddress string, rtype string) {
+// BindVerify sends a TSIG signed SOA query for the zone, which fails if the server rejects the key.
+func BindVerify(server string, keyName string, keySecret string, zone string) error {
 
 	msg := new(dns.Msg)
-	msg.SetUpdate(zone + ".")
+	msg.SetQuestion(dns.Fqdn(zone), dns.TypeSOA)
 
-	oldRR, err := dns.NewRR(fmt.Sprintf("%s. 3600 IN %s %s", recordName, rtype, oldIPAddress))
-	if err != nil {
-		log.Fatalf("Fehler beim Erstellen des alten Records: %v", err)
+	return bindExchange(msg, server, keyName, keySecret)
+}
+
+func bindRR(recordName string, rtype string, content string, ttl uint32) (dns.RR, error) {
+
+	if strings.EqualFold(rtype, "TXT") {
+		content = fmt.Sprintf("%q", content)
 	}
 
-	msg.Remove([]dns.RR{oldRR})
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(recordName), ttl, rtype, content))
+}
 
-	newRR, err := dns.NewRR(fmt.Sprintf("%s. 3600 IN %s %s", recordName, rtype, newIPAddress))
-	if err != nil {
-		log.Fatalf("Fehler beim Erstellen des neuen Records: %v", err)
+func bindContent(rr dns.RR) string {
+
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A.String()
+	case *dns.AAAA:
+		return v.AAAA.String()
+	case *dns.CNAME:
+		return strings.TrimSuffix(v.Target, ".")
+	case *dns.TXT:
+		return strings.Join(v.Txt, "")
 	}
 
-	msg.Insert([]dns.RR{newRR})
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+func bindExchange(msg *dns.Msg, server string, keyName string, keySecret string) error {
+
+	keyName = dns.Fqdn(keyName)
 	msg.SetTsig(keyName, dns.HmacSHA512, 300, time.Now().Unix())
 	client := new(dns.Client)
 	client.TsigSecret = map[string]string{keyName: keySecret}
 
 	resp, _, err := client.Exchange(msg, server)
 	if err != nil {
-		log.Fatalf("Fehler bei DNS-Update: %v", err)
+		return fmt.Errorf("DNS update failed: %w", err)
 	}
 
 	if resp.Rcode != dns.RcodeSuccess {
-		log.Fatalf("DNS-Update fehlgeschlagen: %v", dns.RcodeToString[resp.Rcode])
+		return bindError(resp.Rcode)
 	}
 
-	fmt.Println("DNS-Update erfolgreich!")
+	return nil
 }
@@ -0,0 +1,199 @@
+package dnsapi
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testKeyName   = "dns-manager."
+	testKeySecret = "c2VjcmV0"
+)
+
+// startBindServer answers DNS messages on a local UDP port with handler and returns its address.
+func startBindServer(t *testing.T, secrets map[string]string, handler dns.HandlerFunc) string {
+
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		Handler:           handler,
+		TsigSecret:        secrets,
+		NotifyStartedFunc: func() { close(started) },
+		// Der Standard lehnt alles außer Queries und Notifies ab, also auch Updates.
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+// signedReply answers a request and signs the reply like BIND, if the request was signed.
+func signedReply(w dns.ResponseWriter, r *dns.Msg, reply *dns.Msg) {
+
+	if tsig := r.IsTsig(); tsig != nil {
+		if w.TsigStatus() != nil {
+			reply.Rcode = dns.RcodeNotAuth
+		}
+		reply.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, int64(tsig.TimeSigned))
+	}
+	_ = w.WriteMsg(reply)
+}
+
+func TestBindInsertRecordSignsTheUpdate(t *testing.T) {
+
+	var update *dns.Msg
+	server := startBindServer(t, map[string]string{testKeyName: testKeySecret}, func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.IsTsig() != nil && w.TsigStatus() == nil {
+			update = r
+		}
+		signedReply(w, r, new(dns.Msg).SetReply(r))
+	})
+
+	if err := BindInsertRecord(server, "dns-manager", testKeySecret, "example.com", "shop.example.com", "hello world", "TXT", 300); err != nil {
+		t.Fatalf("BindInsertRecord: %v", err)
+	}
+
+	if update == nil {
+		t.Fatal("the server received no signed update")
+	}
+	if update.Opcode != dns.OpcodeUpdate || update.Question[0].Name != "example.com." {
+		t.Errorf("update = %v, want an update of zone example.com.", update)
+	}
+	if tsig := update.IsTsig(); tsig.Algorithm != dns.HmacSHA512 {
+		t.Errorf("algorithm = %s, want %s", tsig.Algorithm, dns.HmacSHA512)
+	}
+	if len(update.Ns) != 1 {
+		t.Fatalf("update inserts %d records, want 1", len(update.Ns))
+	}
+	txt, ok := update.Ns[0].(*dns.TXT)
+	if !ok || txt.Hdr.Name != "shop.example.com." || txt.Hdr.Ttl != 300 || len(txt.Txt) != 1 || txt.Txt[0] != "hello world" {
+		t.Errorf("inserted record = %v, want shop.example.com. 300 TXT \"hello world\"", update.Ns[0])
+	}
+}
+
+func TestBindUpdateRecordReplacesTheOldRecord(t *testing.T) {
+
+	var update *dns.Msg
+	server := startBindServer(t, map[string]string{testKeyName: testKeySecret}, func(w dns.ResponseWriter, r *dns.Msg) {
+		update = r
+		signedReply(w, r, new(dns.Msg).SetReply(r))
+	})
+
+	if err := BindUpdateRecord(server, "dns-manager", testKeySecret, "example.com", "shop.example.com", "192.0.2.20", "192.0.2.10", "A", 300); err != nil {
+		t.Fatalf("BindUpdateRecord: %v", err)
+	}
+
+	if len(update.Ns) != 2 {
+		t.Fatalf("update has %d records, want 2", len(update.Ns))
+	}
+	// Die Löschung eines einzelnen Records trägt die Klasse NONE (RFC 2136, Abschnitt 2.5.4).
+	removed, inserted := update.Ns[0].(*dns.A), update.Ns[1].(*dns.A)
+	if removed.Hdr.Class != dns.ClassNONE || removed.A.String() != "192.0.2.10" {
+		t.Errorf("removed record = %v, want 192.0.2.10 with class NONE", removed)
+	}
+	if inserted.Hdr.Class != dns.ClassINET || inserted.A.String() != "192.0.2.20" {
+		t.Errorf("inserted record = %v, want 192.0.2.20", inserted)
+	}
+}
+
+func TestBindExchangeFailsWithAWrongKey(t *testing.T) {
+
+	server := startBindServer(t, map[string]string{testKeyName: "b3RoZXI="}, func(w dns.ResponseWriter, r *dns.Msg) {
+		signedReply(w, r, new(dns.Msg).SetReply(r))
+	})
+
+	if err := BindVerify(server, "dns-manager", testKeySecret, "example.com"); err == nil {
+		t.Fatal("BindVerify succeeded with a key the server does not accept")
+	}
+}
+
+func TestBindExchangeReportsTheRcode(t *testing.T) {
+
+	server := startBindServer(t, map[string]string{testKeyName: testKeySecret}, func(w dns.ResponseWriter, r *dns.Msg) {
+		signedReply(w, r, new(dns.Msg).SetRcode(r, dns.RcodeRefused))
+	})
+
+	err := BindDeleteRecord(server, "dns-manager", testKeySecret, "example.com", "shop.example.com", "192.0.2.10", "A")
+	if err == nil {
+		t.Fatal("BindDeleteRecord succeeded although the server refused the update")
+	}
+	if IsTransient(err) {
+		t.Errorf("a refused update is reported as transient: %v", err)
+	}
+}
+
+func TestBindGetRecordsParsesTheAnswer(t *testing.T) {
+
+	server := startBindServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+		reply := new(dns.Msg).SetReply(r)
+		for _, rr := range []string{
+			`shop.example.com. 300 IN TXT "heritage=" "kube-dns-manager"`,
+			`shop.example.com. 300 IN A 192.0.2.10`,
+		} {
+			record, _ := dns.NewRR(rr)
+			reply.Answer = append(reply.Answer, record)
+		}
+		_ = w.WriteMsg(reply)
+	})
+
+	records, err := BindGetRecords(server, "shop.example.com", "txt")
+	if err != nil {
+		t.Fatalf("BindGetRecords: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("records = %v, want one TXT record", records)
+	}
+	want := Record{Type: "TXT", Name: "shop.example.com", Content: "heritage=kube-dns-manager"}
+	if records[0] != want {
+		t.Errorf("record = %+v, want %+v", records[0], want)
+	}
+}
+
+func TestBindGetRecordsSkipsOtherNames(t *testing.T) {
+
+	server := startBindServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+		reply := new(dns.Msg).SetReply(r)
+		for _, rr := range []string{
+			`shop.example.com. 300 IN CNAME lb.example.com.`,
+			`lb.example.com. 300 IN A 192.0.2.10`,
+		} {
+			record, _ := dns.NewRR(rr)
+			reply.Answer = append(reply.Answer, record)
+		}
+		_ = w.WriteMsg(reply)
+	})
+
+	records, err := BindGetRecords(server, "Shop.Example.com", "A")
+	if err != nil {
+		t.Fatalf("BindGetRecords: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("records = %v, want none for the target of the CNAME", records)
+	}
+}
+
+func TestBindGetRecordsTreatsNXDomainAsEmpty(t *testing.T) {
+
+	server := startBindServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+		_ = w.WriteMsg(new(dns.Msg).SetRcode(r, dns.RcodeNameError))
+	})
+
+	records, err := BindGetRecords(server, "missing.example.com", "A")
+	if err != nil {
+		t.Fatalf("BindGetRecords: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("records = %v, want none", records)
+	}
+}
@@ -207,7 +207,6 @@ func DeleteRecord(zoneID string, token string, recordID string) (bool, error) {
 
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
-		fmt.Println("Fehler beim Erstellen des DELETE-Requests:", err)
 		return false, err
 	}
 
@@ -216,18 +215,172 @@ func DeleteRecord(zoneID string, token string, recordID string) (bool, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println("Fehler beim Senden des DELETE-Requests:", err)
 		return false, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		fmt.Println("DNS-Record erfolgreich gelöscht.")
-	} else {
-		fmt.Printf("Fehler beim Löschen des DNS-Records. Status Code: %d\n", resp.StatusCode)
-		return false, err
+	if resp.StatusCode != http.StatusOK {
+		return false, cloudflareError(resp)
 	}
 
 	return true, nil
 
 }
+
+func GetRecords(zoneID string, token string, domain string, rtype string) ([]Record, error) {
+
+	url := "https://api.cloudflare.com/client/v4/zones/" + zoneID + "/dns_records?type=" + rtype + "&name=" + domain
+
+	client := &http.Client{}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, cloudflareError(resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Result, nil
+
+}
+
+// UpdateRecordById replaces the content of a record. A ttl of 1 means automatic.
+func UpdateRecordById(zoneID string, token string, recordID string, domain string, rtype string, content string, ttl int, proxied bool) error {
+
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, recordID)
+
+	dnsRecord := DNSRecord{
+		Type:    rtype,
+		Name:    domain,
+		Content: content,
+		TTL:     ttl,
+		Proxied: proxied,
+	}
+
+	jsonData, err := json.Marshal(dnsRecord)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return cloudflareError(resp)
+	}
+
+	return nil
+
+}
+
+// CreateRecord creates a record and returns it with its ID. A ttl of 1 means automatic.
+func CreateRecord(zoneID string, token string, domain string, rtype string, content string, ttl int, proxied bool) (Record, error) {
+
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID)
+
+	dnsRecord := DNSRecord{
+		Type:    rtype,
+		Name:    domain,
+		Content: content,
+		TTL:     ttl,
+		Proxied: proxied,
+	}
+
+	jsonData, err := json.Marshal(dnsRecord)
+	if err != nil {
+		return Record{}, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return Record{}, err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Record{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Record{}, cloudflareError(resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Record{}, err
+	}
+
+	var response RecordResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Record{}, err
+	}
+
+	return response.Result, nil
+
+}
+
+// VerifyZone checks that the token may access the zone.
+func VerifyZone(zoneID string, token string) error {
+
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s", zoneID)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return cloudflareError(resp)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,83 @@
+package dnsapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// APIError is returned when a DNS provider rejects a request.
+type APIError struct {
+	Provider string
+	// Code is the HTTP status code for Cloudflare and the DNS rcode for BIND.
+	Code    int
+	Message string
+	// Transient is set for errors that are likely to go away by retrying, e.g. rate limits.
+	Transient bool
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s request failed with code %d: %s", e.Provider, e.Code, e.Message)
+}
+
+// IsTransient reports whether retrying the request that returned err may succeed.
+// Network errors and provider errors marked as transient are; everything else is not.
+func IsTransient(err error) bool {
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Transient
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsRateLimited reports whether the provider rejected a request because of its rate limit.
+func IsRateLimited(err error) bool {
+
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Provider == ProviderCloudflare && apiErr.Code == http.StatusTooManyRequests
+}
+
+// cloudflareError turns an unsuccessful Cloudflare response into an APIError.
+func cloudflareError(resp *http.Response) error {
+
+	message := http.StatusText(resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		var response Response
+		if json.Unmarshal(body, &response) == nil && len(response.Errors) > 0 {
+			var messages []string
+			for _, e := range response.Errors {
+				messages = append(messages, e.Message)
+			}
+			message = strings.Join(messages, ", ")
+		}
+	}
+
+	return &APIError{
+		Provider:  ProviderCloudflare,
+		Code:      resp.StatusCode,
+		Message:   message,
+		Transient: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError,
+	}
+}
+
+// bindError turns an unsuccessful DNS response code into an APIError.
+func bindError(rcode int) error {
+
+	return &APIError{
+		Provider:  ProviderBind,
+		Code:      rcode,
+		Message:   dns.RcodeToString[rcode],
+		Transient: rcode == dns.RcodeServerFailure,
+	}
+}
@@ -0,0 +1,204 @@
+package dnsapi
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderBind       = "bind"
+)
+
+// Provider manages the records of a single DNS zone.
+type Provider interface {
+	// GetRecords returns the records of the given type for a name. An empty slice means none exist.
+	GetRecords(name string, rtype string) ([]Record, error)
+	AddRecord(name string, rtype string, content string) (Record, error)
+	UpdateRecord(record Record, content string) error
+	DeleteRecord(record Record) error
+	// Zone identifies the zone the provider writes to.
+	Zone() string
+}
+
+// Verifier is implemented by providers that can check their credentials without writing records.
+type Verifier interface {
+	// Verify checks that the provider accepts the credentials for its zone.
+	Verify() error
+}
+
+// WildcardProvider is implemented by providers that can publish wildcard records such as
+// *.apps.example.com.
+type WildcardProvider interface {
+	SupportsWildcards() bool
+}
+
+// NewProvider returns the provider for a dns.configuration/type value, configured
+// from the data of the ConfigMap or Secret named by dns.configuration/source.
+// The optional keys ttl and, for Cloudflare, proxied apply to every record written;
+// wildcards "false" refuses wildcard records for zones that must not have them.
+func NewProvider(ptype string, config map[string]string) (Provider, error) {
+
+	ttl := 0
+	if value, found := config["ttl"]; found {
+		var err error
+		if ttl, err = strconv.Atoi(value); err != nil || ttl < 1 {
+			return nil, fmt.Errorf("invalid ttl %q", value)
+		}
+	}
+	wildcards := true
+	if value, found := config["wildcards"]; found {
+		var err error
+		if wildcards, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid wildcards %q", value)
+		}
+	}
+
+	switch ptype {
+	case ProviderCloudflare:
+		if config["zoneid"] == "" || config["token"] == "" {
+			return nil, fmt.Errorf("cloudflare configuration requires zoneid and token")
+		}
+		proxied := false
+		if value, found := config["proxied"]; found {
+			var err error
+			if proxied, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("invalid proxied %q", value)
+			}
+		}
+		return &CloudflareProvider{
+			ZoneID:      config["zoneid"],
+			Token:       config["token"],
+			Proxied:     proxied,
+			TTL:         ttl,
+			NoWildcards: !wildcards,
+		}, nil
+	case ProviderBind:
+		if config["bindServer"] == "" || config["zone"] == "" {
+			return nil, fmt.Errorf("bind configuration requires bindServer and zone")
+		}
+		port := config["bindPort"]
+		if port == "" {
+			port = "53"
+		}
+		keyName := config["keyname"]
+		if keyName == "" {
+			keyName = "kube-dns-manager"
+		}
+		if ttl == 0 {
+			ttl = 3600
+		}
+		return &BindProvider{
+			Server:      net.JoinHostPort(config["bindServer"], port),
+			KeyName:     keyName,
+			KeySecret:   config["hmackey"],
+			ZoneName:    config["zone"],
+			TTL:         uint32(ttl),
+			NoWildcards: !wildcards,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown DNS provider type %q", ptype)
+}
+
+// CloudflareProvider manages records through the Cloudflare API.
+type CloudflareProvider struct {
+	ZoneID  string
+	Token   string
+	Proxied bool
+	// TTL of the records in seconds, 0 lets Cloudflare choose.
+	TTL int
+	// NoWildcards refuses wildcard records in the zone.
+	NoWildcards bool
+}
+
+func (p *CloudflareProvider) GetRecords(name string, rtype string) ([]Record, error) {
+	return GetRecords(p.ZoneID, p.Token, name, strings.ToUpper(rtype))
+}
+
+func (p *CloudflareProvider) AddRecord(name string, rtype string, content string) (Record, error) {
+	return CreateRecord(p.ZoneID, p.Token, name, rtype, content, p.ttl(), p.proxied(rtype))
+}
+
+func (p *CloudflareProvider) UpdateRecord(record Record, content string) error {
+	return UpdateRecordById(p.ZoneID, p.Token, record.ID, record.Name, record.Type, content, p.ttl(), p.proxied(record.Type))
+}
+
+// ttl returns the TTL to send, 1 means automatic.
+func (p *CloudflareProvider) ttl() int {
+	if p.TTL == 0 {
+		return 1
+	}
+	return p.TTL
+}
+
+// proxied reports whether a record is proxied; Cloudflare only proxies address records.
+func (p *CloudflareProvider) proxied(rtype string) bool {
+	return p.Proxied && (strings.EqualFold(rtype, "A") || strings.EqualFold(rtype, "AAAA") || strings.EqualFold(rtype, "CNAME"))
+}
+
+func (p *CloudflareProvider) DeleteRecord(record Record) error {
+	if ok, err := DeleteRecord(p.ZoneID, p.Token, record.ID); !ok {
+		if err == nil {
+			err = fmt.Errorf("failed to delete %s record %s", record.Type, record.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *CloudflareProvider) Zone() string {
+	return p.ZoneID
+}
+
+func (p *CloudflareProvider) Verify() error {
+	return VerifyZone(p.ZoneID, p.Token)
+}
+
+func (p *CloudflareProvider) SupportsWildcards() bool {
+	return !p.NoWildcards
+}
+
+// BindProvider manages records through RFC 2136 dynamic updates signed with TSIG.
+type BindProvider struct {
+	Server    string
+	KeyName   string
+	KeySecret string
+	ZoneName  string
+	TTL       uint32
+	// NoWildcards refuses wildcard records in the zone.
+	NoWildcards bool
+}
+
+func (p *BindProvider) GetRecords(name string, rtype string) ([]Record, error) {
+	return BindGetRecords(p.Server, name, rtype)
+}
+
+func (p *BindProvider) AddRecord(name string, rtype string, content string) (Record, error) {
+	if err := BindInsertRecord(p.Server, p.KeyName, p.KeySecret, p.ZoneName, name, content, rtype, p.TTL); err != nil {
+		return Record{}, err
+	}
+	return Record{Type: rtype, Name: name, Content: content}, nil
+}
+
+func (p *BindProvider) UpdateRecord(record Record, content string) error {
+	return BindUpdateRecord(p.Server, p.KeyName, p.KeySecret, p.ZoneName, record.Name, content, record.Content, record.Type, p.TTL)
+}
+
+func (p *BindProvider) DeleteRecord(record Record) error {
+	return BindDeleteRecord(p.Server, p.KeyName, p.KeySecret, p.ZoneName, record.Name, record.Content, record.Type)
+}
+
+func (p *BindProvider) Zone() string {
+	return p.ZoneName
+}
+
+func (p *BindProvider) Verify() error {
+	return BindVerify(p.Server, p.KeyName, p.KeySecret, p.ZoneName)
+}
+
+func (p *BindProvider) SupportsWildcards() bool {
+	return !p.NoWildcards
+}
@@ -0,0 +1,35 @@
+package dnsapi
+
+import "testing"
+
+func TestNewProviderReadsWildcards(t *testing.T) {
+
+	configs := map[string]map[string]string{
+		ProviderCloudflare: {"zoneid": "zone", "token": "token"},
+		ProviderBind:       {"bindServer": "127.0.0.1", "zone": "example.com"},
+	}
+
+	for ptype, config := range configs {
+		provider, err := NewProvider(ptype, config)
+		if err != nil {
+			t.Fatalf("%s: %v", ptype, err)
+		}
+		if !provider.(WildcardProvider).SupportsWildcards() {
+			t.Errorf("%s: wildcards are refused by default", ptype)
+		}
+
+		config["wildcards"] = "false"
+		provider, err = NewProvider(ptype, config)
+		if err != nil {
+			t.Fatalf("%s: %v", ptype, err)
+		}
+		if provider.(WildcardProvider).SupportsWildcards() {
+			t.Errorf("%s: wildcards are supported with wildcards: false", ptype)
+		}
+
+		config["wildcards"] = "sometimes"
+		if _, err := NewProvider(ptype, config); err == nil {
+			t.Errorf("%s: invalid wildcards value accepted", ptype)
+		}
+	}
+}
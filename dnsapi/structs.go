@@ -1,7 +1,17 @@
 package dnsapi
 
 type Response struct {
-	Result []Record `json:"result"`
+	Result []Record        `json:"result"`
+	Errors []ResponseError `json:"errors"`
+}
+
+type RecordResponse struct {
+	Result Record `json:"result"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type Record struct {
@@ -0,0 +1,135 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"time"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+const (
+	// minRetryDelay is the delay after the first failed attempt; it doubles with every further attempt.
+	minRetryDelay = 5 * time.Second
+	// maxRetryDelay caps the backoff and is used for permanent failures, so they are
+	// picked up again eventually once the cause has been fixed outside the cluster.
+	maxRetryDelay = 10 * time.Minute
+)
+
+// permanentError marks an error that retrying will not fix until the configuration changes.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks err as permanent.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent reports whether retrying an error is pointless until the configuration changes.
+// Errors are transient unless they are marked as permanent or the provider rejected the
+// request for a reason other than a rate limit or a server error.
+func isPermanent(err error) bool {
+
+	var permanentErr *permanentError
+	if errors.As(err, &permanentErr) {
+		return true
+	}
+
+	var apiErr *dnsapi.APIError
+	if errors.As(err, &apiErr) {
+		return !dnsapi.IsTransient(err)
+	}
+
+	return false
+}
+
+// newHostFailure records a failed attempt for a host, counting on from its previous failure.
+func newHostFailure(previous []dnsv1.HostFailure, host string, err error) dnsv1.HostFailure {
+
+	failure := dnsv1.HostFailure{
+		Host:      host,
+		Message:   err.Error(),
+		Permanent: isPermanent(err),
+		Attempts:  1,
+	}
+	for _, p := range previous {
+		if p.Host == host {
+			failure.Attempts = p.Attempts + 1
+		}
+	}
+
+	return failure
+}
+
+// retryDelay returns the exponential backoff after a number of failed attempts.
+func retryDelay(attempts int32) time.Duration {
+
+	delay := minRetryDelay
+	for i := int32(1); i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+
+	return delay
+}
+
+// requeueAfter returns when the failed hosts should be retried next, or 0 if nothing failed.
+func requeueAfter(failures []dnsv1.HostFailure) time.Duration {
+
+	var after time.Duration
+	for _, failure := range failures {
+		delay := maxRetryDelay
+		if !failure.Permanent {
+			delay = retryDelay(failure.Attempts)
+		}
+		if after == 0 || delay < after {
+			after = delay
+		}
+	}
+
+	return after
+}
+
+// retryableFailures returns the hosts whose failures are worth retrying.
+func retryableFailures(failures []dnsv1.HostFailure) []string {
+
+	var hosts []string
+	for _, failure := range failures {
+		if !failure.Permanent {
+			hosts = append(hosts, failure.Host)
+		}
+	}
+
+	return hosts
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+// targetBinding is one entry of dns.configuration/targets: a provider, selected like with the
+// provider annotations, and the targets its records point to.
+type targetBinding struct {
+	Type            string `yaml:"type"`
+	Source          string `yaml:"source"`
+	Provider        string `yaml:"provider"`
+	ClusterProvider string `yaml:"clusterProvider"`
+	// TargetService is the namespace/name of the Service whose LoadBalancer address the
+	// records point to. Without it, and without TargetNodes, the records point to the
+	// targets of the operator configuration.
+	TargetService string `yaml:"targetService"`
+	// TargetNodes makes the records point to the nodes of the targetNodes configuration.
+	TargetNodes bool `yaml:"targetNodes"`
+}
+
+// ref returns the reference of the provider a binding selects.
+func (b targetBinding) ref() dnsv1.ProviderReference {
+
+	switch {
+	case b.Provider != "":
+		return dnsv1.ProviderReference{Kind: dnsv1.KindDNSProvider, Name: b.Provider}
+	case b.ClusterProvider != "":
+		return dnsv1.ProviderReference{Kind: dnsv1.KindClusterDNSProvider, Name: b.ClusterProvider}
+	default:
+		return dnsv1.ProviderReference{Type: b.Type, Source: b.Source}
+	}
+}
+
+// parseTargetBindings parses the value of dns.configuration/targets, a YAML list of bindings:
+//
+//   - type: cloudflare
+//     source: cloudflare-config
+//     targetService: kube-system/traefik-public
+//   - provider: internal-bind
+//     targetService: kube-system/traefik-internal
+func parseTargetBindings(value string) ([]targetBinding, error) {
+
+	var bindings []targetBinding
+	decoder := yaml.NewDecoder(strings.NewReader(value))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&bindings); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", targetsAnnotationKey, err)
+	}
+	if len(bindings) == 0 {
+		return nil, fmt.Errorf("%s lists no provider", targetsAnnotationKey)
+	}
+
+	for i, binding := range bindings {
+		selected := 0
+		for _, set := range []bool{binding.Provider != "", binding.ClusterProvider != "", binding.Type != "" || binding.Source != ""} {
+			if set {
+				selected++
+			}
+		}
+		if selected != 1 || binding.Provider == "" && binding.ClusterProvider == "" && (binding.Type == "" || binding.Source == "") {
+			return nil, fmt.Errorf("entry %d of %s must select one provider with type and source, provider or clusterProvider", i, targetsAnnotationKey)
+		}
+		if binding.TargetService != "" {
+			if binding.TargetNodes {
+				return nil, fmt.Errorf("entry %d of %s sets both targetService and targetNodes", i, targetsAnnotationKey)
+			}
+			if namespace, name, found := strings.Cut(binding.TargetService, "/"); !found || namespace == "" || name == "" {
+				return nil, fmt.Errorf("entry %d of %s: targetService %q must be namespace/name", i, targetsAnnotationKey, binding.TargetService)
+			}
+		}
+		for _, other := range bindings[:i] {
+			if other.ref() == binding.ref() {
+				return nil, fmt.Errorf("%s lists %s more than once", targetsAnnotationKey, refName(binding.ref()))
+			}
+		}
+	}
+
+	return bindings, nil
+}
+
+// bindingTargets returns the record type and the addresses the records of a binding point to.
+func bindingTargets(ctx context.Context, c client.Reader, binding targetBinding, cfg operatorConfig) (string, []string, error) {
+
+	switch {
+	case binding.TargetService != "":
+		namespace, name, _ := strings.Cut(binding.TargetService, "/")
+		return serviceTargets(ctx, c, []dnsv1.ServiceReference{{Namespace: namespace, Name: name}})
+	case binding.TargetNodes:
+		if cfg.TargetNodes == nil {
+			return "", nil, permanent(fmt.Errorf("targetNodes is not configured in the DNSManagerConfig"))
+		}
+		return nodeTargets(ctx, c, cfg)
+	default:
+		return ingressTargets(ctx, c, cfg)
+	}
+}
+
+// syncBindings publishes the hostnames of an Ingress with every binding of
+// dns.configuration/targets. Each binding only touches the records and failures of its own
+// provider, so the providers are tracked independently. Records of providers no binding
+// selects any more are removed after the bindings are published, see removeMovedRecords.
+func (r *IngressReconciler) syncBindings(ctx context.Context, ingress *networkingv1.Ingress, bindings []targetBinding, hosts []string, previous dnsv1.DNSRecordSetStatus, conflicts []dnsv1.HostConflict, cfg operatorConfig) dnsv1.DNSRecordSetStatus {
+	logger := log.FromContext(ctx)
+	w := r.writer().withConfig(cfg)
+
+	status := dnsv1.DNSRecordSetStatus{Conflicts: conflicts}
+	var refs []dnsv1.ProviderReference
+	for _, binding := range bindings {
+		ref, err := w.normalizeRef(ingress.Namespace, binding.ref())
+		if err != nil {
+			// Without knowing which records belong to the binding, none are removed
+			logger.Error(err, "Failed to select DNS provider", "provider", refName(binding.ref()))
+			status := dnsv1.DNSRecordSetStatus{Records: previous.Records, Conflicts: conflicts}
+			for _, host := range hosts {
+				status.Failures = append(status.Failures, w.hostFailed(ingress, previous.Failures, host, err))
+			}
+			return status
+		}
+		refs = append(refs, ref)
+
+		// The records and failures of this binding
+		var bindingPrevious dnsv1.DNSRecordSetStatus
+		for _, record := range previous.Records {
+			if w.recordProvider(record) == ref {
+				bindingPrevious.Records = append(bindingPrevious.Records, record)
+			}
+		}
+		for _, failure := range previous.Failures {
+			if failure.Provider == bindingName(ref) {
+				bindingPrevious.Failures = append(bindingPrevious.Failures, failure)
+			}
+		}
+
+		provider, err := r.providerFor(ctx, ingress, ref, cfg)
+		if err == nil && provider == nil {
+			err = permanent(fmt.Errorf("unknown DNS configuration type %s, must be %s or %s", ref.Type, dnsapi.ProviderCloudflare, dnsapi.ProviderBind))
+		}
+		var recordType string
+		var targets []string
+		if err == nil {
+			recordType, targets, err = bindingTargets(ctx, r.Client, binding, cfg)
+		}
+
+		var bindingStatus dnsv1.DNSRecordSetStatus
+		if err != nil {
+			// Keep what was published with the binding before
+			logger.Error(err, "Failed to prepare DNS records", "provider", refName(ref))
+			bindingStatus.Records = bindingPrevious.Records
+			for _, host := range hosts {
+				bindingStatus.Failures = append(bindingStatus.Failures, w.hostFailed(ingress, bindingPrevious.Failures, host, err))
+			}
+		} else {
+			bindingStatus = w.syncRecords(ctx, ingress, provider, desiredRecords(hosts, recordType, targets), bindingPrevious, conflicts)
+		}
+
+		status.Records = append(status.Records, bindingStatus.Records...)
+		for _, failure := range bindingStatus.Failures {
+			failure.Provider = bindingName(ref)
+			status.Failures = append(status.Failures, failure)
+		}
+	}
+
+	// Records written with providers that were removed from the bindings
+	var moved []dnsv1.ManagedRecord
+	for _, record := range previous.Records {
+		if !containsRef(refs, w.recordProvider(record)) {
+			moved = append(moved, record)
+		}
+	}
+
+	return w.removeMovedRecords(ctx, ingress, moved, desiredRecords(hosts, "", nil), status, previous.Failures)
+}
+
+// bindingName returns the name the failures of a binding are tracked under. Unlike refName it
+// tells types with sources of the same name apart.
+func bindingName(ref dnsv1.ProviderReference) string {
+
+	if ref.Kind != "" {
+		return refName(ref)
+	}
+
+	return ref.Type + "/" + ref.Source
+}
+
+// containsRef reports whether refs contains ref.
+func containsRef(refs []dnsv1.ProviderReference, ref dnsv1.ProviderReference) bool {
+
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("Provider bindings", func() {
+	const (
+		namespace = "shop"
+		bindings  = `- type: cloudflare
+  source: cloudflare-config
+  targetService: kube-system/traefik-public
+- type: bind
+  source: bind-config
+  targetService: kube-system/traefik-internal
+`
+	)
+
+	ctx := context.Background()
+
+	var (
+		public     *fakeProvider
+		internal   *fakeProvider
+		recorder   *events.FakeRecorder
+		reconciler *IngressReconciler
+		ingress    *k8snetworkingv1.Ingress
+		objects    []client.Object
+	)
+
+	reconcileIngress := func() *networkingv1.DNSRecordSet {
+		if reconciler == nil {
+			reconciler = newTestReconciler("kube-system", public, append(objects, ingress)...)
+			reconciler.Recorder = recorder
+			reconciler.NewProvider = func(ptype string, c map[string]string) (dnsapi.Provider, error) {
+				if ptype == dnsapi.ProviderBind {
+					return internal, nil
+				}
+				return public, nil
+			}
+		}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+
+		var recordSet networkingv1.DNSRecordSet
+		if err := reconciler.Get(ctx, client.ObjectKey{Name: "ingress-" + ingress.Name, Namespace: ingress.Namespace}, &recordSet); err != nil {
+			return nil
+		}
+		return &recordSet
+	}
+
+	// update changes the targets annotation of the stored Ingress.
+	update := func(value string) {
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+		ingress.Annotations[targetsAnnotationKey] = value
+		Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		public = &fakeProvider{ptype: dnsapi.ProviderCloudflare}
+		internal = &fakeProvider{ptype: dnsapi.ProviderBind, failing: map[string]error{}}
+		recorder = events.NewFakeRecorder(20)
+		reconciler = nil
+		ingress = &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web",
+				Namespace:   namespace,
+				Annotations: map[string]string{targetsAnnotationKey: bindings},
+			},
+			Spec: k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}}},
+		}
+		objects = []client.Object{
+			loadBalancer("traefik", "192.0.2.10"),
+			loadBalancer("traefik-public", "203.0.113.10"),
+			loadBalancer("traefik-internal", "10.0.0.10"),
+			cloudflareSource("cloudflare-config", "kube-system"),
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "bind-config", Namespace: "kube-system"},
+				Data:       map[string]string{"server": "10.0.0.53", "zone": "example.com"},
+			},
+		}
+	})
+
+	It("should publish the hostnames with every provider and its targets", func() {
+		recordSet := reconcileIngress()
+
+		Expect(public.content("shop.example.com", "A")).To(ConsistOf("203.0.113.10"))
+		Expect(internal.content("shop.example.com", "A")).To(ConsistOf("10.0.0.10"))
+		Expect(recordSet.Status.Records).To(HaveLen(2))
+		Expect(recordSet.Status.Failures).To(BeEmpty())
+	})
+
+	It("should only remove the records of a removed binding", func() {
+		reconcileIngress()
+		update(`- type: cloudflare
+  source: cloudflare-config
+  targetService: kube-system/traefik-public
+`)
+		recordSet := reconcileIngress()
+
+		Expect(public.content("shop.example.com", "A")).To(ConsistOf("203.0.113.10"))
+		Expect(internal.content("shop.example.com", "A")).To(BeEmpty())
+		Expect(internal.content("shop.example.com", "TXT")).To(BeEmpty())
+		Expect(recordSet.Status.Records).To(HaveLen(1))
+		Expect(recordSet.Status.Records[0].Provider).To(Equal(dnsapi.ProviderCloudflare))
+	})
+
+	It("should keep a record another binding wrote to the same zone", func() {
+		objects = append(objects, cloudflareSource("cloudflare-copy", "kube-system"))
+		ingress.Annotations[targetsAnnotationKey] = `- type: bind
+  source: bind-config
+  targetService: kube-system/traefik-internal
+- type: cloudflare
+  source: cloudflare-config
+  targetService: kube-system/traefik-public
+`
+		reconcileIngress()
+		// cloudflare-copy holds other credentials for the zone of cloudflare-config
+		update(`- type: bind
+  source: bind-config
+  targetService: kube-system/traefik-internal
+- type: cloudflare
+  source: cloudflare-copy
+  targetService: kube-system/traefik-public
+`)
+		recordSet := reconcileIngress()
+
+		Expect(public.content("shop.example.com", "A")).To(ConsistOf("203.0.113.10"))
+		Expect(public.content("shop.example.com", "TXT")).NotTo(BeEmpty())
+		Expect(internal.content("shop.example.com", "A")).To(ConsistOf("10.0.0.10"))
+		Expect(recordSet.Status.Records).To(HaveLen(2))
+		Expect(recordSet.Status.Failures).To(BeEmpty())
+	})
+
+	It("should track failures per provider", func() {
+		internal.failing["shop.example.com"] = errors.New("connection refused")
+		recordSet := reconcileIngress()
+
+		Expect(public.content("shop.example.com", "A")).To(ConsistOf("203.0.113.10"))
+		Expect(recordSet.Status.Records).To(HaveLen(1))
+		Expect(recordSet.Status.Failures).To(HaveLen(1))
+		Expect(recordSet.Status.Failures[0].Provider).To(Equal("bind/kube-system/bind-config"))
+
+		delete(internal.failing, "shop.example.com")
+		recordSet = reconcileIngress()
+		Expect(internal.content("shop.example.com", "A")).To(ConsistOf("10.0.0.10"))
+		Expect(recordSet.Status.Records).To(HaveLen(2))
+		Expect(recordSet.Status.Failures).To(BeEmpty())
+	})
+
+	It("should keep the records of a binding whose target is missing", func() {
+		reconcileIngress()
+		update(`- type: cloudflare
+  source: cloudflare-config
+  targetService: kube-system/traefik-public
+- type: bind
+  source: bind-config
+  targetService: kube-system/missing
+`)
+		recordSet := reconcileIngress()
+
+		Expect(public.content("shop.example.com", "A")).To(ConsistOf("203.0.113.10"))
+		Expect(internal.content("shop.example.com", "A")).To(ConsistOf("10.0.0.10"))
+		Expect(recordSet.Status.Records).To(HaveLen(2))
+		Expect(recordSet.Status.Failures).To(HaveLen(1))
+	})
+
+	It("should share the deletion limit between the providers", func() {
+		objects = append(objects, &networkingv1.DNSManagerConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+			Spec:       networkingv1.DNSManagerConfigSpec{Limits: networkingv1.SafetyLimits{MaxDeletionsPerReconcile: 1}},
+		})
+		reconcileIngress()
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+		ingress.Spec.Rules = []k8snetworkingv1.IngressRule{{Host: "cart.example.com"}}
+		Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+		recordSet := reconcileIngress()
+
+		remaining := len(public.content("shop.example.com", "A")) + len(internal.content("shop.example.com", "A"))
+		Expect(remaining).To(Equal(1))
+		Expect(recordSet.Status.Failures).To(HaveLen(1))
+
+		reconcileIngress()
+		Expect(public.content("shop.example.com", "A")).To(BeEmpty())
+		Expect(internal.content("shop.example.com", "A")).To(BeEmpty())
+	})
+
+	It("should remove the records of every provider when the Ingress is deleted", func() {
+		reconcileIngress()
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+		Expect(reconciler.Delete(ctx, ingress)).To(Succeed())
+		reconcileIngress()
+
+		Expect(public.records).To(BeEmpty())
+		Expect(internal.records).To(BeEmpty())
+		err := reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should not publish with an invalid annotation", func() {
+		ingress.Annotations[targetsAnnotationKey] = "- type: cloudflare\n"
+		Expect(reconcileIngress()).To(BeNil())
+
+		Expect(public.records).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning InvalidTargets")))
+	})
+
+	It("should reject invalid bindings", func() {
+		for value, message := range map[string]string{
+			"type: cloudflare": "invalid",
+			"[]":               "lists no provider",
+			"- provider: a\n  type: cloudflare\n  source: b\n":           "must select one provider",
+			"- provider: a\n  targetService: traefik\n":                  "must be namespace/name",
+			"- provider: a\n  targetService: a/b\n  targetNodes: true\n": "sets both",
+			"- provider: a\n- provider: a\n":                             "more than once",
+			"- provider: a\n  zone: b\n":                                 "field zone not found",
+		} {
+			_, err := parseTargetBindings(value)
+			Expect(err).To(MatchError(ContainSubstring(message)), value)
+		}
+	})
+})
@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// ClusterDNSProviderReconciler reconciles a ClusterDNSProvider object
+type ClusterDNSProviderReconciler struct {
+	client.Client
+	Scheme        *runtime.Scheme
+	ConfigMapName string
+	// ConfigMapNamespace is where Secrets are read from if a selector names no namespace.
+	ConfigMapNamespace string
+
+	NewProvider ProviderFactory
+}
+
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=clusterdnsproviders,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=clusterdnsproviders/status,verbs=get;update;patch
+
+// writer returns the recordWriter that checks the configuration and Secrets of a
+// ClusterDNSProvider.
+func (r *ClusterDNSProviderReconciler) writer() *recordWriter {
+	return &recordWriter{
+		Client:             r.Client,
+		ConfigMapName:      r.ConfigMapName,
+		ConfigMapNamespace: r.ConfigMapNamespace,
+		NewProvider:        r.NewProvider,
+	}
+}
+
+// Reconcile validates the credentials of a ClusterDNSProvider and reports the result in its Ready condition.
+func (r *ClusterDNSProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var dnsProvider dnsv1.ClusterDNSProvider
+	if err := r.Get(ctx, req.NamespacedName, &dnsProvider); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	condition, err := r.writer().validateProvider(ctx, dnsProvider.Spec, "")
+	condition.ObservedGeneration = dnsProvider.Generation
+	dnsProvider.Status.ObservedGeneration = dnsProvider.Generation
+	meta.SetStatusCondition(&dnsProvider.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, &dnsProvider); err != nil {
+		logger.Error(err, "Failed to update ClusterDNSProvider status")
+		return ctrl.Result{}, err
+	}
+
+	return validationResult(ctx, condition, err)
+}
+
+// providersForSecret maps a Secret to the ClusterDNSProviders that read it.
+func (r *ClusterDNSProviderReconciler) providersForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	var providers dnsv1.ClusterDNSProviderList
+	if err := r.List(ctx, &providers); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list ClusterDNSProviders")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, dnsProvider := range providers.Items {
+		for _, selector := range providerSecrets(dnsProvider.Spec) {
+			if selector.Name == obj.GetName() && r.writer().secretNamespace("", selector) == obj.GetNamespace() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&dnsProvider)})
+				break
+			}
+		}
+	}
+
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterDNSProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&dnsv1.ClusterDNSProvider{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.providersForSecret)).
+		Named("clusterdnsprovider").
+		Complete(r)
+}
@@ -0,0 +1,412 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// operatorConfig holds the settings of the DNSManagerConfig, or of the ConfigMap it replaces.
+type operatorConfig struct {
+	TargetServices  []dnsv1.ServiceReference
+	TargetNodes     *dnsv1.NodeTargets
+	ExcludeDomains  []string
+	IncludeDomains  []string
+	IncludeTLSHosts bool
+	DeletionPolicy  string
+	DefaultProvider *dnsv1.ProviderReference
+	ResyncInterval  time.Duration
+	OwnerID         string
+	Limits          dnsv1.SafetyLimits
+
+	NamespaceLocalSources  bool
+	SharedSourceNamespaces []string
+
+	excludePatterns []*regexp.Regexp
+	includePatterns []*regexp.Regexp
+	nodeSelector    labels.Selector
+
+	hostnameTemplates *hostnameTemplates
+
+	// scope is the IngressScope of the writer that loaded the configuration
+	scope IngressScope
+	// deletions is the deletion budget of the reconcile that loaded the configuration. All
+	// removals of the reconcile take from it, whichever writer makes them.
+	deletions *deletionBudget
+}
+
+// excludes reports whether the configuration keeps a hostname from being published. The
+// same check applies when records are added, removed and cleaned up, so a hostname that
+// becomes excluded is no longer touched at all.
+func (c operatorConfig) excludes(host string) bool {
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, domain := range c.ExcludeDomains {
+		if matchesDomain(host, domain, false) {
+			return true
+		}
+	}
+	if matchesPattern(host, c.excludePatterns) {
+		return true
+	}
+
+	if len(c.IncludeDomains) == 0 && len(c.includePatterns) == 0 {
+		return false
+	}
+	for _, domain := range c.IncludeDomains {
+		if matchesDomain(host, domain, true) {
+			return false
+		}
+	}
+
+	return !matchesPattern(host, c.includePatterns)
+}
+
+// matchesDomain reports whether a normalized host matches a domain filter entry. "*.domain"
+// matches the subdomains of domain; otherwise the host must equal domain, or with
+// subdomains also be below it.
+func matchesDomain(host, domain string, subdomains bool) bool {
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if suffix, found := strings.CutPrefix(domain, "*"); found {
+		return strings.HasSuffix(host, suffix)
+	}
+
+	return host == domain || subdomains && strings.HasSuffix(host, "."+domain)
+}
+
+func matchesPattern(host string, patterns []*regexp.Regexp) bool {
+
+	for _, pattern := range patterns {
+		if pattern.MatchString(host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errDeletionLimit is the failure of records kept because of the deletion limit.
+var errDeletionLimit = fmt.Errorf("maxDeletionsPerReconcile reached, the records are removed on a later reconcile")
+
+// deletionBudget counts the record removals a reconcile may still make.
+type deletionBudget struct {
+	limited bool
+	left    int32
+}
+
+// deletionBudget returns the budget of the limits for one reconcile.
+func (c operatorConfig) deletionBudget() *deletionBudget {
+	return &deletionBudget{limited: c.Limits.MaxDeletionsPerReconcile > 0, left: c.Limits.MaxDeletionsPerReconcile}
+}
+
+// take reports whether one more host may be removed, and counts it if so.
+func (b *deletionBudget) take() bool {
+
+	if !b.limited {
+		return true
+	}
+	if b.left == 0 {
+		return false
+	}
+
+	b.left--
+	return true
+}
+
+// ownerValue returns the content of the ownership TXT records.
+func (c operatorConfig) ownerValue() string {
+
+	if c.OwnerID == "" {
+		return ownerTXTValue
+	}
+
+	return ownerTXTValue + "/owner=" + c.OwnerID
+}
+
+// ingressProviderRef returns the provider for an Ingress, see providerRef. Ingresses outside
+// the scope have none. An invalid dns.configuration/targets annotation is returned as error.
+func (c operatorConfig) ingressProviderRef(ingress *networkingv1.Ingress) (dnsv1.ProviderReference, bool, error) {
+
+	if !c.scope.Matches(ingress) {
+		return dnsv1.ProviderReference{}, false, nil
+	}
+
+	// With dns.configuration/targets the Ingress is published with every provider it lists
+	if value, found := ingress.Annotations[targetsAnnotationKey]; found {
+		bindings, err := parseTargetBindings(value)
+		if err != nil {
+			return dnsv1.ProviderReference{}, false, err
+		}
+		return bindings[0].ref(), true, nil
+	}
+
+	ref, found := c.providerRef(ingress.Annotations)
+	return ref, found, nil
+}
+
+// providerRef returns the provider for a source with annotations: the one its annotations
+// select, or the default provider if it has no provider annotations at all.
+func (c operatorConfig) providerRef(annotations map[string]string) (dnsv1.ProviderReference, bool) {
+
+	if ref, found := annotationProviderRef(annotations); found {
+		return ref, true
+	}
+
+	if hasProviderAnnotation(annotations) {
+		return dnsv1.ProviderReference{}, false
+	}
+	if c.DefaultProvider != nil {
+		return *c.DefaultProvider, true
+	}
+
+	return dnsv1.ProviderReference{}, false
+}
+
+// hasProviderAnnotation reports whether annotations hold any of the provider annotations,
+// complete or not.
+func hasProviderAnnotation(annotations map[string]string) bool {
+
+	for _, key := range []string{typeAnnotationKey, sourceAnnotationKey, providerAnnotationKey, clusterProviderAnnotationKey, targetsAnnotationKey} {
+		if _, found := annotations[key]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadOperatorConfig reads the DNSManagerConfig named ConfigMapName in ConfigMapNamespace.
+// Without one, it falls back to a ConfigMap of that name and then to the defaults. The
+// writer uses the owner ID and source settings of the configuration from then on.
+func (w *recordWriter) loadOperatorConfig(ctx context.Context) (operatorConfig, error) {
+
+	cfg, err := w.readOperatorConfig(ctx)
+	if err != nil {
+		return operatorConfig{}, err
+	}
+
+	cfg.scope = w.Scope
+	cfg.deletions = cfg.deletionBudget()
+	w.cfg = cfg
+	return cfg, nil
+}
+
+// withConfig makes the writer use an operator configuration that was loaded before.
+func (w *recordWriter) withConfig(cfg operatorConfig) *recordWriter {
+	w.cfg = cfg
+	return w
+}
+
+func (w *recordWriter) readOperatorConfig(ctx context.Context) (operatorConfig, error) {
+
+	key := client.ObjectKey{Namespace: w.ConfigMapNamespace, Name: w.ConfigMapName}
+
+	var managerConfig dnsv1.DNSManagerConfig
+	err := w.Get(ctx, key, &managerConfig)
+	if err == nil {
+		cfg, err := parseManagerConfig(managerConfig.Spec)
+		if err != nil {
+			return operatorConfig{}, fmt.Errorf("invalid DNSManagerConfig %s: %w", key, err)
+		}
+		return cfg, nil
+	}
+	if !errors.IsNotFound(err) {
+		return operatorConfig{}, fmt.Errorf("failed to load DNSManagerConfig: %w", err)
+	}
+
+	spec, err := w.loadConfigMap(ctx)
+	if err != nil {
+		return operatorConfig{}, err
+	}
+
+	cfg, err := parseManagerConfig(spec)
+	if err != nil {
+		return operatorConfig{}, fmt.Errorf("invalid ConfigMap %s: %w", key, err)
+	}
+
+	return cfg, nil
+}
+
+// Konfiguration aus der ConfigMap laden. Die ConfigMap wird durch DNSManagerConfig ersetzt.
+func (w *recordWriter) loadConfigMap(ctx context.Context) (dnsv1.DNSManagerConfigSpec, error) {
+
+	var configMap corev1.ConfigMap
+
+	err := w.Get(ctx, client.ObjectKey{
+		Namespace: w.ConfigMapNamespace,
+		Name:      w.ConfigMapName,
+	}, &configMap)
+
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Standardwerte, wenn die ConfigMap nicht gefunden wird
+			return dnsv1.DNSManagerConfigSpec{}, nil
+		}
+		return dnsv1.DNSManagerConfigSpec{}, fmt.Errorf("failed to load ConfigMap: %w", err)
+	}
+	log.FromContext(ctx).Info("The operator ConfigMap is deprecated, use a DNSManagerConfig instead", "configMap", w.ConfigMapName)
+
+	spec := dnsv1.DNSManagerConfigSpec{DeletionPolicy: configMap.Data["deletionPolicy"]}
+
+	// Standardwerte für Traefik
+	traefikServiceName := configMap.Data["traefikServiceName"]
+	if traefikServiceName == "" {
+		traefikServiceName = "traefik"
+	}
+
+	traefikNamespace := configMap.Data["traefikNamespace"]
+	if traefikNamespace == "" {
+		traefikNamespace = "kube-system"
+	}
+	spec.TargetServices = []dnsv1.ServiceReference{{Name: traefikServiceName, Namespace: traefikNamespace}}
+
+	// ExcludeDomains aus YAML laden, excludeDomains ist die Schreibweise aus älteren READMEs
+	for _, key := range []string{"excludedomains", "excludeDomains"} {
+		if excludeDomainsRaw, found := configMap.Data[key]; found {
+			var excludeDomains []string
+			if err := yaml.Unmarshal([]byte(excludeDomainsRaw), &excludeDomains); err != nil {
+				return dnsv1.DNSManagerConfigSpec{}, fmt.Errorf("failed to parse %s: %w", key, err)
+			}
+			spec.ExcludeDomains = append(spec.ExcludeDomains, excludeDomains...)
+		}
+	}
+
+	return spec, nil
+}
+
+// parseManagerConfig validates a DNSManagerConfig spec and fills in the defaults.
+func parseManagerConfig(spec dnsv1.DNSManagerConfigSpec) (operatorConfig, error) {
+
+	cfg := operatorConfig{
+		TargetServices:  spec.TargetServices,
+		TargetNodes:     spec.TargetNodes,
+		ExcludeDomains:  spec.ExcludeDomains,
+		IncludeDomains:  spec.IncludeDomains,
+		IncludeTLSHosts: spec.IncludeTLSHosts,
+		DeletionPolicy:  spec.DeletionPolicy,
+		DefaultProvider: spec.DefaultProvider,
+		OwnerID:         spec.OwnerID,
+		Limits:          spec.Limits,
+
+		NamespaceLocalSources:  spec.NamespaceLocalSources,
+		SharedSourceNamespaces: spec.SharedSourceNamespaces,
+	}
+
+	if len(cfg.TargetServices) == 0 {
+		cfg.TargetServices = []dnsv1.ServiceReference{{Name: "traefik", Namespace: "kube-system"}}
+	}
+
+	switch cfg.DeletionPolicy {
+	case "":
+		cfg.DeletionPolicy = DeletionPolicyDelete
+	case DeletionPolicyDelete, DeletionPolicyRetain:
+	default:
+		return operatorConfig{}, fmt.Errorf("invalid deletionPolicy %q, must be %q or %q", cfg.DeletionPolicy, DeletionPolicyDelete, DeletionPolicyRetain)
+	}
+
+	var invalid []string
+	for _, domain := range append(append([]string{}, cfg.ExcludeDomains...), cfg.IncludeDomains...) {
+		name := strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(domain, ".")), "*.")
+		if len(validation.IsDNS1123Subdomain(name)) > 0 {
+			invalid = append(invalid, domain)
+		}
+	}
+	if len(invalid) > 0 {
+		return operatorConfig{}, fmt.Errorf("invalid domains %s", strings.Join(invalid, ", "))
+	}
+
+	var err error
+	if cfg.excludePatterns, err = compilePatterns("excludePatterns", spec.ExcludePatterns); err != nil {
+		return operatorConfig{}, err
+	}
+	if cfg.includePatterns, err = compilePatterns("includePatterns", spec.IncludePatterns); err != nil {
+		return operatorConfig{}, err
+	}
+	if cfg.hostnameTemplates, err = parseHostnameTemplates(spec.HostnameTemplates); err != nil {
+		return operatorConfig{}, err
+	}
+
+	if nodes := cfg.TargetNodes; nodes != nil {
+		switch corev1.NodeAddressType(nodes.AddressType) {
+		case "":
+			cfg.TargetNodes = nodes.DeepCopy()
+			cfg.TargetNodes.AddressType = string(corev1.NodeExternalIP)
+		case corev1.NodeExternalIP, corev1.NodeInternalIP:
+		default:
+			return operatorConfig{}, fmt.Errorf("invalid targetNodes addressType %q, must be %q or %q", nodes.AddressType, corev1.NodeExternalIP, corev1.NodeInternalIP)
+		}
+		cfg.nodeSelector = labels.Everything()
+		if nodes.Selector != nil {
+			if cfg.nodeSelector, err = metav1.LabelSelectorAsSelector(nodes.Selector); err != nil {
+				return operatorConfig{}, fmt.Errorf("invalid targetNodes selector: %w", err)
+			}
+		}
+	}
+
+	for _, namespace := range cfg.SharedSourceNamespaces {
+		if len(validation.IsDNS1123Label(namespace)) > 0 {
+			return operatorConfig{}, fmt.Errorf("invalid sharedSourceNamespaces entry %q", namespace)
+		}
+	}
+
+	if ref := cfg.DefaultProvider; ref != nil && ref.Kind == dnsv1.KindDNSProvider {
+		return operatorConfig{}, fmt.Errorf("the default provider cannot be a namespaced DNSProvider")
+	}
+
+	if spec.ResyncInterval != nil {
+		if spec.ResyncInterval.Duration < 0 {
+			return operatorConfig{}, fmt.Errorf("invalid resyncInterval %s", spec.ResyncInterval.Duration)
+		}
+		cfg.ResyncInterval = spec.ResyncInterval.Duration
+	}
+
+	return cfg, nil
+}
+
+// compilePatterns compiles the regular expressions of a filter. Hostnames are matched in
+// lower case and without a trailing dot.
+func compilePatterns(field string, patterns []string) ([]*regexp.Regexp, error) {
+
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %w", field, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
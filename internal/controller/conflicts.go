@@ -0,0 +1,224 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+const (
+	// hostIndexKey indexes managed Ingresses by the hostnames of their rules.
+	hostIndexKey = "spec.rules.host"
+
+	// priorityAnnotation decides hostname conflicts between Ingresses; the higher value wins.
+	priorityAnnotation = "dns.configuration/priority"
+)
+
+// indexIngressHosts returns the hostnames of the rules of an Ingress. Whether kube-dns-manager
+// publishes them depends on the operator configuration and is checked by hostOwner.
+func indexIngressHosts(obj client.Object) []string {
+
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+
+	// The TLS hosts are indexed as well; hostOwner skips them unless they are published
+	return ingressHosts(ingress, true)
+}
+
+// ingressHosts returns the normalized hostnames of the rules of an Ingress and, with tls,
+// of its spec.tls.
+func ingressHosts(ingress *networkingv1.Ingress, tls bool) []string {
+
+	var hosts []string
+	for _, rule := range ingress.Spec.Rules {
+		hosts = append(hosts, rule.Host)
+	}
+	if tls {
+		for _, entry := range ingress.Spec.TLS {
+			hosts = append(hosts, entry.Hosts...)
+		}
+	}
+
+	return normalizeHosts(hosts)
+}
+
+// normalizeHosts returns the hostnames in lower case and without a trailing dot, leaving out
+// empty and repeated ones.
+func normalizeHosts(hosts []string) []string {
+
+	var normalized []string
+	for _, host := range hosts {
+		host = normalizeHost(host)
+		if host != "" && !containsString(normalized, host) {
+			normalized = append(normalized, host)
+		}
+	}
+
+	return normalized
+}
+
+// normalizeHost returns a hostname in lower case and without a trailing dot.
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+}
+
+// hostOwner returns the Ingress that may publish a hostname, chosen among all Ingresses that
+// declare it or get it generated, select a provider under cfg and are not being deleted. It
+// returns nil if no such Ingress exists.
+func hostOwner(ctx context.Context, c client.Reader, host string, cfg operatorConfig) (*networkingv1.Ingress, error) {
+
+	var ingresses networkingv1.IngressList
+	if err := c.List(ctx, &ingresses, client.MatchingFields{hostIndexKey: host}); err != nil {
+		return nil, err
+	}
+	candidates := make([]*networkingv1.Ingress, 0, len(ingresses.Items))
+	for i := range ingresses.Items {
+		candidates = append(candidates, &ingresses.Items[i])
+	}
+
+	// Generated hostnames depend on the configuration and are not in the cache index
+	generated, err := cfg.objectsGenerating(ctx, c, &networkingv1.IngressList{}, "Ingress", cfg.declaredIngressHosts, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range generated {
+		candidates = append(candidates, obj.(*networkingv1.Ingress))
+	}
+
+	var owner *networkingv1.Ingress
+	for _, candidate := range candidates {
+		if !candidate.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if _, found, err := cfg.ingressProviderRef(candidate); err != nil || !found {
+			continue
+		}
+		if !containsString(cfg.ingressHostnames(candidate), host) {
+			continue
+		}
+		if owner == nil || ownsBefore(candidate, owner) {
+			owner = candidate
+		}
+	}
+
+	return owner, nil
+}
+
+// ownsBefore reports whether object a wins a hostname conflict against b. The higher
+// dns.configuration/priority wins, then the older object, then the lower namespace/name.
+func ownsBefore(a client.Object, b client.Object) bool {
+
+	if pa, pb := objectPriority(a), objectPriority(b); pa != pb {
+		return pa > pb
+	}
+
+	ca, cb := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !ca.Equal(&cb) {
+		return ca.Before(&cb)
+	}
+
+	return client.ObjectKeyFromObject(a).String() < client.ObjectKeyFromObject(b).String()
+}
+
+// objectPriority returns the dns.configuration/priority of an object, 0 if unset or invalid.
+func objectPriority(obj client.Object) int {
+
+	priority, err := strconv.Atoi(obj.GetAnnotations()[priorityAnnotation])
+	if err != nil {
+		return 0
+	}
+
+	return priority
+}
+
+// resolveConflicts splits hostnames into the ones the Ingress owns and the ones another
+// Ingress owns.
+func (r *IngressReconciler) resolveConflicts(ctx context.Context, ingress *networkingv1.Ingress, hosts []string, cfg operatorConfig) ([]string, []dnsv1.HostConflict, error) {
+	logger := log.FromContext(ctx)
+
+	owned := []string{}
+	var conflicts []dnsv1.HostConflict
+
+	for _, host := range hosts {
+		owner, err := hostOwner(ctx, r.Client, host, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if owner == nil || (owner.Namespace == ingress.Namespace && owner.Name == ingress.Name) {
+			owned = append(owned, host)
+			continue
+		}
+
+		ownerName := client.ObjectKeyFromObject(owner).String()
+		logger.Info("Host is published by another Ingress. Skipping...", "domain", host, "owner", ownerName)
+		r.writer().recordEvent(ingress, corev1.EventTypeWarning, reasonHostConflict, "Host %s is already published by Ingress %s", host, ownerName)
+		conflicts = append(conflicts, dnsv1.HostConflict{Host: host, Owner: ownerName})
+	}
+
+	return owned, conflicts, nil
+}
+
+// ingressesSharingHosts maps an Ingress to the other Ingresses that declare one of its hostnames,
+// so they can take a hostname over when its owner changes or goes away.
+func (r *IngressReconciler) ingressesSharingHosts(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	var requests []reconcile.Request
+	seen := map[types.NamespacedName]bool{client.ObjectKeyFromObject(obj): true}
+
+	hosts := indexIngressHosts(obj)
+	if cfg, err := r.writer().loadOperatorConfig(ctx); err == nil && cfg.generatesHosts() {
+		if ingress, ok := obj.(*networkingv1.Ingress); ok {
+			hosts = normalizeHosts(append(hosts, cfg.ingressHostnames(ingress)...))
+		}
+		for _, request := range objectsGeneratingHosts(ctx, r.Client, &networkingv1.IngressList{}, "Ingress", cfg.declaredIngressHosts, hosts, obj, cfg) {
+			seen[request.NamespacedName] = true
+			requests = append(requests, request)
+		}
+	}
+
+	for _, host := range hosts {
+		var ingresses networkingv1.IngressList
+		if err := r.List(ctx, &ingresses, client.MatchingFields{hostIndexKey: host}); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list Ingresses by host", "domain", host)
+			continue
+		}
+
+		for _, ingress := range ingresses.Items {
+			key := client.ObjectKeyFromObject(&ingress)
+			if !seen[key] {
+				seen[key] = true
+				requests = append(requests, reconcile.Request{NamespacedName: key})
+			}
+		}
+	}
+
+	return requests
+}
@@ -0,0 +1,462 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// endpointHostnameIndexKey indexes DNSEndpoints by their hostname.
+const endpointHostnameIndexKey = "spec.hostname"
+
+// providerSpecificKeys are the provider settings a DNSEndpoint may set.
+var providerSpecificKeys = []string{"proxied"}
+
+// DNSEndpointReconciler reconciles a DNSEndpoint object
+type DNSEndpointReconciler struct {
+	client.Client
+	Scheme             *runtime.Scheme
+	ConfigMapName      string
+	ConfigMapNamespace string
+	Recorder           events.EventRecorder
+
+	NewProvider ProviderFactory
+
+	// Scope is the scope of the IngressReconciler. Ingresses outside it own no hostnames.
+	Scope IngressScope
+}
+
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsendpoints,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsendpoints/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsendpoints/finalizers,verbs=update
+
+// writer returns the recordWriter that publishes the records of DNSEndpoints.
+func (r *DNSEndpointReconciler) writer() *recordWriter {
+	return &recordWriter{
+		Client:             r.Client,
+		ConfigMapName:      r.ConfigMapName,
+		ConfigMapNamespace: r.ConfigMapNamespace,
+		Recorder:           r.Recorder,
+		NewProvider:        r.NewProvider,
+		Scope:              r.Scope,
+	}
+}
+
+// Reconcile publishes the records of a DNSEndpoint and removes them when it is deleted.
+// Hostnames published by an Ingress or another source take precedence over DNSEndpoints,
+// see endpointOwner.
+func (r *DNSEndpointReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	w := r.writer()
+
+	var endpoint dnsv1.DNSEndpoint
+	if err := r.Get(ctx, req.NamespacedName, &endpoint); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get DNSEndpoint")
+		return ctrl.Result{}, err
+	}
+
+	cfg, err := w.loadOperatorConfig(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to load operator configuration")
+		return ctrl.Result{}, err
+	}
+
+	recordSet, err := getRecordSet(ctx, r.Client, r.Scheme, &endpoint)
+	if err != nil {
+		logger.Error(err, "Failed to load DNSRecordSet")
+		return ctrl.Result{}, err
+	}
+	var previous dnsv1.DNSRecordSetStatus
+	if recordSet != nil {
+		previous = recordSet.Status
+	}
+
+	if !endpoint.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&endpoint, cleanupFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		status, err := r.cleanupRecords(ctx, &endpoint, previous, cfg)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if len(retryableFailures(status.Failures)) > 0 {
+			return r.saveStatus(ctx, &endpoint, status, nil)
+		}
+
+		controllerutil.RemoveFinalizer(&endpoint, cleanupFinalizer)
+		return ctrl.Result{}, r.Update(ctx, &endpoint)
+	}
+
+	if controllerutil.AddFinalizer(&endpoint, cleanupFinalizer) {
+		if err := r.Update(ctx, &endpoint); err != nil {
+			logger.Error(err, "Failed to add finalizer to DNSEndpoint")
+			return ctrl.Result{}, err
+		}
+	}
+
+	host := endpointHostname(&endpoint)
+	publish := true
+	status := dnsv1.DNSRecordSetStatus{}
+
+	var excluded []string
+	if cfg.excludes(host) {
+		w.recordEvent(&endpoint, corev1.EventTypeNormal, reasonDomainExcluded, "Host %s is excluded by the operator configuration, no DNS records are published", host)
+		excluded = append(excluded, host)
+		publish = false
+	}
+
+	owner, err := endpointOwner(ctx, r.Client, host, cfg)
+	if err != nil {
+		logger.Error(err, "Failed to check for hostname conflicts")
+		return ctrl.Result{}, err
+	}
+	if owner != nil && !ownedBy(owner, &endpoint) && publish {
+		ownerName := client.ObjectKeyFromObject(owner).String()
+		ownerKind := sourceKind(owner)
+		w.recordEvent(&endpoint, corev1.EventTypeWarning, reasonHostConflict, "Host %s is already published by %s %s", host, ownerKind, ownerName)
+		conflict := dnsv1.HostConflict{Host: host, Owner: ownerName}
+		if ownerKind != "Ingress" {
+			conflict.Kind = ownerKind
+		}
+		status.Conflicts = append(status.Conflicts, conflict)
+		publish = false
+	}
+
+	// Remove the records of a previous hostname; records of an excluded or taken over hostname are left alone
+	for _, record := range previous.Records {
+		if record.Host == host {
+			continue
+		}
+		if cfg.excludes(record.Host) {
+			logger.Info("Domain excluded from processing", "domain", record.Host)
+			continue
+		}
+		if owner, err := endpointOwner(ctx, r.Client, record.Host, cfg); err != nil {
+			return ctrl.Result{}, err
+		} else if owner != nil && !ownedBy(owner, &endpoint) {
+			logger.Info("Host is taken over by another object", "domain", record.Host, "kind", sourceKind(owner), "owner", client.ObjectKeyFromObject(owner).String())
+			continue
+		}
+		if !cfg.deletions.take() {
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, newHostFailure(previous.Failures, record.Host, errDeletionLimit))
+			continue
+		}
+		if err := w.removeRecord(ctx, &endpoint, record); err != nil {
+			logger.Error(err, "Failed to delete DNS records", "domain", record.Host)
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, w.hostFailed(&endpoint, previous.Failures, record.Host, err))
+		}
+	}
+
+	if !publish {
+		return r.saveStatus(ctx, &endpoint, status, excluded)
+	}
+
+	record, err := r.publish(ctx, &endpoint, cfg)
+	switch {
+	case err == errRecordNotOwned:
+		w.recordEvent(&endpoint, corev1.EventTypeWarning, reasonRecordNotOwned, "Record %s exists but is not owned by kube-dns-manager", host)
+		if previousRecord, found := findRecord(previous.Records, host); found {
+			status.Records = append(status.Records, previousRecord)
+		}
+		status.Failures = append(status.Failures, newHostFailure(previous.Failures, host, permanent(err)))
+	case err != nil:
+		logger.Error(err, "Failed to create or update DNS records", "domain", host)
+		if previousRecord, found := findRecord(previous.Records, host); found {
+			status.Records = append(status.Records, previousRecord)
+		}
+		status.Failures = append(status.Failures, w.hostFailed(&endpoint, previous.Failures, host, err))
+	default:
+		status.Records = append(status.Records, record)
+	}
+
+	result, err := r.saveStatus(ctx, &endpoint, status, excluded)
+	if err == nil && result.RequeueAfter == 0 {
+		result.RequeueAfter = cfg.ResyncInterval
+	}
+
+	return result, err
+}
+
+// cleanupRecords removes or releases the records of a deleted DNSEndpoint with its deletion
+// policy, unless another object takes their hostname over.
+func (r *DNSEndpointReconciler) cleanupRecords(ctx context.Context, endpoint *dnsv1.DNSEndpoint, previous dnsv1.DNSRecordSetStatus, cfg operatorConfig) (dnsv1.DNSRecordSetStatus, error) {
+	logger := log.FromContext(ctx)
+	w := r.writer().withConfig(cfg)
+
+	policy := deletionPolicy(ctx, endpoint, cfg)
+	logger.Info("Cleaning up DNS records for deleted DNSEndpoint", "deletionPolicy", policy)
+
+	var status dnsv1.DNSRecordSetStatus
+	for _, record := range previous.Records {
+		if cfg.excludes(record.Host) {
+			continue
+		}
+
+		owner, err := endpointOwner(ctx, r.Client, record.Host, cfg)
+		if err != nil {
+			return dnsv1.DNSRecordSetStatus{}, err
+		}
+		if owner != nil {
+			logger.Info("Host is taken over by another object", "domain", record.Host, "kind", sourceKind(owner), "owner", client.ObjectKeyFromObject(owner).String())
+			continue
+		}
+
+		if !cfg.deletions.take() {
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, newHostFailure(previous.Failures, record.Host, errDeletionLimit))
+			continue
+		}
+		if err := w.cleanupRecord(ctx, endpoint, record, policy); err != nil {
+			logger.Error(err, "Failed to clean up DNS records", "domain", record.Host)
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, w.hostFailed(endpoint, previous.Failures, record.Host, err))
+		}
+	}
+
+	return status, nil
+}
+
+// endpointOwner returns the object that may publish a hostname a DNSEndpoint declares. Ingresses
+// and the objects of the other sources win, see sourceOwner; among the DNSEndpoints that are
+// not being deleted ownsBefore decides. It returns nil if no object publishes the hostname.
+func endpointOwner(ctx context.Context, c client.Reader, host string, cfg operatorConfig) (client.Object, error) {
+
+	host = normalizeHost(host)
+	owner, err := sourceOwner(ctx, c, host, cfg)
+	if err != nil || owner != nil {
+		return owner, err
+	}
+
+	var endpoints dnsv1.DNSEndpointList
+	if err := c.List(ctx, &endpoints, client.MatchingFields{endpointHostnameIndexKey: host}); err != nil {
+		return nil, err
+	}
+
+	for i := range endpoints.Items {
+		candidate := &endpoints.Items[i]
+		if !candidate.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if owner == nil || ownsBefore(candidate, owner) {
+			owner = candidate
+		}
+	}
+
+	return owner, nil
+}
+
+// ownedBy reports whether the owner returned by endpointOwner is the DNSEndpoint itself.
+func ownedBy(owner client.Object, endpoint *dnsv1.DNSEndpoint) bool {
+
+	_, ok := owner.(*dnsv1.DNSEndpoint)
+	return ok && client.ObjectKeyFromObject(owner) == client.ObjectKeyFromObject(endpoint)
+}
+
+// publish writes the records of a DNSEndpoint.
+func (r *DNSEndpointReconciler) publish(ctx context.Context, endpoint *dnsv1.DNSEndpoint, cfg operatorConfig) (dnsv1.ManagedRecord, error) {
+
+	w := r.writer().withConfig(cfg)
+	spec := endpoint.Spec
+	host := endpointHostname(endpoint)
+
+	recordType, err := endpointRecordType(spec)
+	if err != nil {
+		return dnsv1.ManagedRecord{}, permanent(err)
+	}
+
+	overrides := map[string]string{}
+	if spec.TTL > 0 {
+		overrides["ttl"] = strconv.FormatInt(spec.TTL, 10)
+	}
+	for _, property := range spec.ProviderSpecific {
+		if !containsString(providerSpecificKeys, property.Name) {
+			return dnsv1.ManagedRecord{}, permanent(fmt.Errorf("unknown provider specific property %s", property.Name))
+		}
+		overrides[property.Name] = property.Value
+	}
+
+	provider, err := w.provider(ctx, endpoint.Namespace, spec.ProviderRef, overrides)
+	if err != nil {
+		return dnsv1.ManagedRecord{}, err
+	}
+	if err := provider.checkHost(host); err != nil {
+		return dnsv1.ManagedRecord{}, err
+	}
+
+	ids, _, err := w.ensureRecords(ctx, endpoint, provider, host, recordType, spec.Targets)
+	if err != nil {
+		return dnsv1.ManagedRecord{}, err
+	}
+
+	return provider.managedRecord(host, recordType, strings.Join(spec.Targets, ","), ids), nil
+}
+
+// endpointRecordType returns the record type of a DNSEndpoint. All targets must be addresses
+// of that type.
+func endpointRecordType(spec dnsv1.DNSEndpointSpec) (string, error) {
+
+	recordType := spec.RecordType
+	for _, target := range spec.Targets {
+		targetType, err := recordTypeFor(target)
+		if err != nil {
+			return "", err
+		}
+		if recordType == "" {
+			recordType = targetType
+		}
+		if targetType != recordType {
+			return "", fmt.Errorf("target %s is not a valid %s record", target, recordType)
+		}
+	}
+
+	if recordType == "" {
+		return "", fmt.Errorf("no targets")
+	}
+
+	return recordType, nil
+}
+
+// saveStatus stores the DNSRecordSet of a DNSEndpoint, copies its Ready condition to the
+// DNSEndpoint and requeues it if the hostname failed.
+func (r *DNSEndpointReconciler) saveStatus(ctx context.Context, endpoint *dnsv1.DNSEndpoint, status dnsv1.DNSRecordSetStatus, excluded []string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	status.ObservedGeneration = endpoint.Generation
+	summarizeStatus(&status, excluded)
+
+	if err := saveRecordSet(ctx, r.Client, r.Scheme, endpoint, status); err != nil {
+		logger.Error(err, "Failed to update DNSRecordSet")
+		return ctrl.Result{}, err
+	}
+
+	endpoint.Status.ObservedGeneration = endpoint.Generation
+	for _, condition := range status.Conditions {
+		meta.SetStatusCondition(&endpoint.Status.Conditions, condition)
+	}
+	if err := r.Status().Update(ctx, endpoint); err != nil {
+		logger.Error(err, "Failed to update DNSEndpoint status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter(status.Failures)}, nil
+}
+
+// endpointsSharingHosts maps an Ingress, a DNSEndpoint or an object of a hostSource to the
+// other DNSEndpoints with one of its hostnames, so they step back when the object publishes
+// the hostname and take over when it stops.
+func (r *DNSEndpointReconciler) endpointsSharingHosts(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	var hosts []string
+	switch obj.(type) {
+	case *networkingv1.Ingress:
+		hosts = indexIngressHosts(obj)
+	case *dnsv1.DNSEndpoint:
+		hosts = indexEndpointHostname(obj)
+	default:
+		for _, source := range hostSources {
+			if isSourceKind(source, obj) {
+				hosts = source.hosts(obj)
+			}
+		}
+	}
+
+	var requests []reconcile.Request
+	for _, host := range hosts {
+		var endpoints dnsv1.DNSEndpointList
+		if err := r.List(ctx, &endpoints, client.MatchingFields{endpointHostnameIndexKey: host}); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list DNSEndpoints by host", "domain", host)
+			continue
+		}
+		for _, endpoint := range endpoints.Items {
+			if _, ok := obj.(*dnsv1.DNSEndpoint); ok && client.ObjectKeyFromObject(&endpoint) == client.ObjectKeyFromObject(obj) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&endpoint)})
+		}
+	}
+
+	return requests
+}
+
+// indexEndpointHostname returns the normalized hostname of a DNSEndpoint.
+func indexEndpointHostname(obj client.Object) []string {
+
+	endpoint, ok := obj.(*dnsv1.DNSEndpoint)
+	if !ok || endpointHostname(endpoint) == "" {
+		return nil
+	}
+
+	return []string{endpointHostname(endpoint)}
+}
+
+// endpointHostname returns the hostname of a DNSEndpoint in lower case and without a trailing
+// dot, like the hostnames of the other sources.
+func endpointHostname(endpoint *dnsv1.DNSEndpoint) string {
+	return normalizeHost(endpoint.Spec.Hostname)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DNSEndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &dnsv1.DNSEndpoint{}, endpointHostnameIndexKey, indexEndpointHostname); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&dnsv1.DNSEndpoint{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&dnsv1.DNSRecordSet{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&networkingv1.Ingress{}, handler.EnqueueRequestsFromMapFunc(r.endpointsSharingHosts)).
+		Watches(&dnsv1.DNSEndpoint{}, handler.EnqueueRequestsFromMapFunc(r.endpointsSharingHosts))
+
+	for _, source := range hostSources {
+		installed, err := sourceInstalled(mgr, source.newObject())
+		if err != nil {
+			return err
+		}
+		if installed {
+			b = b.Watches(source.newObject(), handler.EnqueueRequestsFromMapFunc(r.endpointsSharingHosts))
+		}
+	}
+
+	return b.Named("dnsendpoint").Complete(r)
+}
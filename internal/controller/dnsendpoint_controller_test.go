@@ -0,0 +1,358 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("DNSEndpoint Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		dnsendpoint := &networkingv1.DNSEndpoint{}
+
+		BeforeEach(func() {
+			requireEnvtest()
+			By("creating the custom resource for the Kind DNSEndpoint")
+			err := k8sClient.Get(ctx, typeNamespacedName, dnsendpoint)
+			if err != nil && errors.IsNotFound(err) {
+				resource := &networkingv1.DNSEndpoint{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName,
+						Namespace: "default",
+					},
+					Spec: networkingv1.DNSEndpointSpec{
+						Hostname:    "test.example.com",
+						Targets:     []string{"192.0.2.1"},
+						ProviderRef: networkingv1.ProviderReference{Type: dnsapi.ProviderCloudflare, Source: "dns-config"},
+					},
+				}
+				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			if k8sClient == nil {
+				return
+			}
+			resource := &networkingv1.DNSEndpoint{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cleanup the specific resource instance DNSEndpoint")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+		It("should successfully reconcile the resource", func() {
+			By("Reconciling the created resource")
+			controllerReconciler := &DNSEndpointReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				ConfigMapName:      "dns-operator-config",
+				ConfigMapNamespace: "default",
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When publishing a DNSEndpoint", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider   *fakeProvider
+			reconciler *DNSEndpointReconciler
+			endpoint   *networkingv1.DNSEndpoint
+		)
+
+		setup := func(objects ...client.Object) {
+			dnsConfig := cloudflareSource("dns-config", namespace)
+			reconciler = &DNSEndpointReconciler{
+				Client:             newFakeClient(append(objects, endpoint, dnsConfig)...),
+				Scheme:             scheme.Scheme,
+				ConfigMapName:      "dns-operator-config",
+				ConfigMapNamespace: namespace,
+				NewProvider:        provider.factory,
+			}
+		}
+
+		reconcileEndpoint := func() {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: endpoint.Name, Namespace: endpoint.Namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		readyCondition := func() *metav1.Condition {
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)).To(Succeed())
+			for i := range endpoint.Status.Conditions {
+				if endpoint.Status.Conditions[i].Type == networkingv1.ConditionReady {
+					return &endpoint.Status.Conditions[i]
+				}
+			}
+			return nil
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			endpoint = &networkingv1.DNSEndpoint{
+				ObjectMeta: metav1.ObjectMeta{Name: "mail", Namespace: namespace, Generation: 1},
+				Spec: networkingv1.DNSEndpointSpec{
+					Hostname: "mail.example.com",
+					Targets:  []string{"192.0.2.25", "192.0.2.26"},
+					TTL:      300,
+					ProviderRef: networkingv1.ProviderReference{
+						Type:   dnsapi.ProviderCloudflare,
+						Source: "dns-config",
+					},
+					ProviderSpecific: []networkingv1.ProviderSpecificProperty{{Name: "proxied", Value: "true"}},
+				},
+			}
+		})
+
+		It("should publish a record for every target", func() {
+			setup()
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(ConsistOf("192.0.2.25", "192.0.2.26"))
+			Expect(provider.content("mail.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+			Expect(provider.config).To(HaveKeyWithValue("ttl", "300"))
+			Expect(provider.config).To(HaveKeyWithValue("proxied", "true"))
+
+			condition := readyCondition()
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(endpoint.Status.ObservedGeneration).To(Equal(endpoint.Generation))
+		})
+
+		It("should converge the records to changed targets", func() {
+			setup()
+			reconcileEndpoint()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)).To(Succeed())
+			endpoint.Spec.Targets = []string{"192.0.2.26", "192.0.2.27"}
+			Expect(reconciler.Update(ctx, endpoint)).To(Succeed())
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(ConsistOf("192.0.2.26", "192.0.2.27"))
+		})
+
+		It("should remove the records of a previous hostname", func() {
+			setup()
+			reconcileEndpoint()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)).To(Succeed())
+			endpoint.Spec.Hostname = "smtp.example.com"
+			Expect(reconciler.Update(ctx, endpoint)).To(Succeed())
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("mail.example.com", "TXT")).To(BeEmpty())
+			Expect(provider.content("smtp.example.com", "A")).To(HaveLen(2))
+		})
+
+		It("should leave a hostname published by an Ingress alone", func() {
+			ingress := &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "mail",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{{Host: "mail.example.com"}},
+				},
+			}
+			setup(ingress)
+			reconcileEndpoint()
+
+			Expect(provider.records).To(BeEmpty())
+			Expect(readyCondition().Reason).To(Equal("HostConflict"))
+		})
+
+		It("should compare hostnames in any spelling", func() {
+			endpoint.Spec.Hostname = "Mail.Example.com."
+			ingress := &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "mail",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{{Host: "mail.example.com"}},
+				},
+			}
+			setup(ingress)
+			reconcileEndpoint()
+
+			Expect(provider.records).To(BeEmpty())
+			Expect(readyCondition().Reason).To(Equal("HostConflict"))
+			Expect(reconciler.endpointsSharingHosts(ctx, ingress)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(endpoint)}))
+		})
+
+		It("should leave a hostname published by a Service alone", func() {
+			service := loadBalancer("mail", "192.0.2.30")
+			service.Namespace = namespace
+			service.Annotations = map[string]string{
+				typeAnnotationKey:     dnsapi.ProviderCloudflare,
+				sourceAnnotationKey:   "dns-config",
+				hostnameAnnotationKey: "mail.example.com",
+			}
+			service.Spec.Type = corev1.ServiceTypeLoadBalancer
+			setup(service)
+			reconcileEndpoint()
+
+			Expect(provider.records).To(BeEmpty())
+			var recordSet networkingv1.DNSRecordSet
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "dnsendpoint-mail", Namespace: namespace}, &recordSet)).To(Succeed())
+			Expect(recordSet.Status.Conflicts).To(ConsistOf(networkingv1.HostConflict{Host: "mail.example.com", Owner: namespace + "/mail", Kind: "Service"}))
+		})
+
+		It("should let the older DNSEndpoint publish a shared hostname", func() {
+			endpoint.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+			newer := endpoint.DeepCopy()
+			newer.Name = "mail-backup"
+			newer.CreationTimestamp = metav1.Now()
+			newer.Spec.Targets = []string{"192.0.2.99"}
+			setup(newer)
+			reconcileEndpoint()
+
+			mail := endpoint
+			endpoint = newer
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(ConsistOf("192.0.2.25", "192.0.2.26"))
+			Expect(readyCondition().Reason).To(Equal("HostConflict"))
+
+			// The newer DNSEndpoint takes over once the older one is deleted
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(mail), mail)).To(Succeed())
+			Expect(reconciler.Delete(ctx, mail)).To(Succeed())
+			endpoint = mail
+			reconcileEndpoint()
+			endpoint = newer
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(ConsistOf("192.0.2.99"))
+			Expect(readyCondition().Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should keep the records of a previous hostname that is now excluded", func() {
+			operatorConfig := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: namespace},
+			}
+			setup(operatorConfig)
+			reconcileEndpoint()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(operatorConfig), operatorConfig)).To(Succeed())
+			operatorConfig.Data = map[string]string{"excludedomains": "- mail.example.com\n"}
+			Expect(reconciler.Update(ctx, operatorConfig)).To(Succeed())
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)).To(Succeed())
+			endpoint.Spec.Hostname = "smtp.example.com"
+			Expect(reconciler.Update(ctx, endpoint)).To(Succeed())
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(ConsistOf("192.0.2.25", "192.0.2.26"))
+			Expect(provider.content("smtp.example.com", "A")).To(HaveLen(2))
+		})
+
+		It("should reject unknown provider specific properties", func() {
+			endpoint.Spec.ProviderSpecific = []networkingv1.ProviderSpecificProperty{{Name: "token", Value: "other"}}
+			setup()
+			reconcileEndpoint()
+
+			Expect(provider.records).To(BeEmpty())
+			Expect(readyCondition().Status).To(Equal(metav1.ConditionFalse))
+		})
+
+		It("should delete the records and the finalizer when the DNSEndpoint is deleted", func() {
+			setup()
+			reconcileEndpoint()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)).To(Succeed())
+			Expect(reconciler.Delete(ctx, endpoint)).To(Succeed())
+			reconcileEndpoint()
+
+			Expect(provider.records).To(BeEmpty())
+			err := reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should apply the deletion policy when the DNSEndpoint is deleted", func() {
+			endpoint.Annotations = map[string]string{deletionPolicyAnnotation: DeletionPolicyRetain}
+			setup()
+			reconcileEndpoint()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)).To(Succeed())
+			Expect(reconciler.Delete(ctx, endpoint)).To(Succeed())
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(ConsistOf("192.0.2.25", "192.0.2.26"))
+			Expect(provider.content("mail.example.com", "TXT")).To(ConsistOf(orphanedTXTValue))
+			err := reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should keep the records of an excluded hostname when the DNSEndpoint is deleted", func() {
+			operatorConfig := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: namespace},
+			}
+			setup(operatorConfig)
+			reconcileEndpoint()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(operatorConfig), operatorConfig)).To(Succeed())
+			operatorConfig.Data = map[string]string{"excludedomains": "- mail.example.com\n"}
+			Expect(reconciler.Update(ctx, operatorConfig)).To(Succeed())
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(endpoint), endpoint)).To(Succeed())
+			Expect(reconciler.Delete(ctx, endpoint)).To(Succeed())
+			reconcileEndpoint()
+
+			Expect(provider.content("mail.example.com", "A")).To(ConsistOf("192.0.2.25", "192.0.2.26"))
+			Expect(provider.content("mail.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+		})
+	})
+})
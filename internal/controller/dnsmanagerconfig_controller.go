@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// reasonNotInUse is the Ready reason of a DNSManagerConfig the operator does not read.
+const reasonNotInUse = "NotInUse"
+
+// DNSManagerConfigReconciler reconciles a DNSManagerConfig object
+type DNSManagerConfigReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// ConfigMapName and ConfigMapNamespace name the DNSManagerConfig the operator reads.
+	ConfigMapName      string
+	ConfigMapNamespace string
+}
+
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsmanagerconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsmanagerconfigs/status,verbs=get;update;patch
+
+// Reconcile validates a DNSManagerConfig and reports the result in its Ready condition.
+func (r *DNSManagerConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var managerConfig dnsv1.DNSManagerConfig
+	if err := r.Get(ctx, req.NamespacedName, &managerConfig); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	condition := metav1.Condition{
+		Type:               dnsv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonConfigurationAccepted,
+		Message:            "The configuration is valid and in use",
+		ObservedGeneration: managerConfig.Generation,
+	}
+	if _, err := parseManagerConfig(managerConfig.Spec); err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonInvalidConfiguration
+		condition.Message = err.Error()
+	} else if managerConfig.Name != r.ConfigMapName || managerConfig.Namespace != r.ConfigMapNamespace {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonNotInUse
+		condition.Message = fmt.Sprintf("The operator reads the DNSManagerConfig %s/%s", r.ConfigMapNamespace, r.ConfigMapName)
+	}
+
+	managerConfig.Status.ObservedGeneration = managerConfig.Generation
+	meta.SetStatusCondition(&managerConfig.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, &managerConfig); err != nil {
+		logger.Error(err, "Failed to update DNSManagerConfig status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DNSManagerConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&dnsv1.DNSManagerConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Named("dnsmanagerconfig").
+		Complete(r)
+}
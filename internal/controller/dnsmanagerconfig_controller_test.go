@@ -0,0 +1,392 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("DNSManagerConfig Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		dnsmanagerconfig := &networkingv1.DNSManagerConfig{}
+
+		BeforeEach(func() {
+			requireEnvtest()
+			By("creating the custom resource for the Kind DNSManagerConfig")
+			err := k8sClient.Get(ctx, typeNamespacedName, dnsmanagerconfig)
+			if err != nil && errors.IsNotFound(err) {
+				resource := &networkingv1.DNSManagerConfig{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName,
+						Namespace: "default",
+					},
+				}
+				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			if k8sClient == nil {
+				return
+			}
+			resource := &networkingv1.DNSManagerConfig{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cleanup the specific resource instance DNSManagerConfig")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+		It("should successfully reconcile the resource", func() {
+			By("Reconciling the created resource")
+			controllerReconciler := &DNSManagerConfigReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				ConfigMapName:      resourceName,
+				ConfigMapNamespace: "default",
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When validating a DNSManagerConfig", func() {
+		ctx := context.Background()
+
+		var managerConfig *networkingv1.DNSManagerConfig
+
+		validate := func() *metav1.Condition {
+			reconciler := &DNSManagerConfigReconciler{
+				Client:             newFakeClient(managerConfig),
+				Scheme:             scheme.Scheme,
+				ConfigMapName:      "dns-operator-config",
+				ConfigMapNamespace: "kube-system",
+			}
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(managerConfig)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(managerConfig), managerConfig)).To(Succeed())
+			return meta.FindStatusCondition(managerConfig.Status.Conditions, networkingv1.ConditionReady)
+		}
+
+		BeforeEach(func() {
+			managerConfig = &networkingv1.DNSManagerConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system", Generation: 3},
+				Spec: networkingv1.DNSManagerConfigSpec{
+					ExcludeDomains: []string{"internal.example.com"},
+					DeletionPolicy: DeletionPolicyRetain,
+				},
+			}
+		})
+
+		It("should report a valid configuration", func() {
+			condition := validate()
+
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal(reasonConfigurationAccepted))
+			Expect(managerConfig.Status.ObservedGeneration).To(Equal(int64(3)))
+		})
+
+		It("should report parse errors", func() {
+			managerConfig.Spec.ExcludeDomains = []string{"internal.example.com", "not a domain"}
+
+			condition := validate()
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(reasonInvalidConfiguration))
+			Expect(condition.Message).To(ContainSubstring("not a domain"))
+		})
+
+		It("should report invalid patterns", func() {
+			managerConfig.Spec.ExcludeDomains = []string{"*.internal.example.com"}
+			managerConfig.Spec.IncludePatterns = []string{"(example"}
+
+			condition := validate()
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Message).To(ContainSubstring("includePatterns"))
+		})
+
+		It("should report a configuration the operator does not read", func() {
+			managerConfig.Name = "other"
+
+			condition := validate()
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(reasonNotInUse))
+		})
+	})
+
+	Context("When publishing with a DNSManagerConfig", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider      *fakeProvider
+			reconciler    *IngressReconciler
+			ingress       *k8snetworkingv1.Ingress
+			managerConfig *networkingv1.DNSManagerConfig
+			objects       []client.Object
+		)
+
+		reconcileIngress := func() (ctrl.Result, *networkingv1.DNSRecordSet) {
+			if reconciler == nil {
+				reconciler = newTestReconciler("kube-system", provider, append(objects, managerConfig, ingress)...)
+			}
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+
+			var recordSet networkingv1.DNSRecordSet
+			key := types.NamespacedName{Name: "ingress-" + ingress.Name, Namespace: namespace}
+			Expect(reconciler.Get(ctx, key, &recordSet)).To(Succeed())
+			return result, &recordSet
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			reconciler = nil
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: namespace},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}},
+				},
+			}
+			managerConfig = &networkingv1.DNSManagerConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+				Spec: networkingv1.DNSManagerConfigSpec{
+					TargetServices: []networkingv1.ServiceReference{
+						{Name: "haproxy", Namespace: "ingress"},
+						{Name: "traefik", Namespace: "kube-system"},
+					},
+					DefaultProvider: &networkingv1.ProviderReference{Kind: networkingv1.KindClusterDNSProvider, Name: "cloudflare"},
+				},
+			}
+			objects = []client.Object{
+				loadBalancer("traefik", "192.0.2.10"),
+				&networkingv1.ClusterDNSProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "cloudflare"},
+					Spec: networkingv1.DNSProviderSpec{
+						Cloudflare: &networkingv1.CloudflareProviderSpec{
+							ZoneID:            "zone",
+							APITokenSecretRef: networkingv1.SecretKeySelector{Name: "cloudflare-token", Key: "token"},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "cloudflare-token", Namespace: "kube-system"},
+					Data:       map[string][]byte{"token": []byte("secret-token")},
+				},
+			}
+		})
+
+		It("should publish Ingresses without annotations with the default provider", func() {
+			_, recordSet := reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("shop.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+			Expect(recordSet.Status.Records[0].ProviderKind).To(Equal(networkingv1.KindClusterDNSProvider))
+		})
+
+		It("should write the owner ID to the ownership records", func() {
+			managerConfig.Spec.OwnerID = "cluster-a"
+			reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "TXT")).To(ConsistOf(ownerTXTValue + "/owner=cluster-a"))
+		})
+
+		It("should leave records of another owner ID alone", func() {
+			managerConfig.Spec.OwnerID = "cluster-a"
+			provider.seed("shop.example.com", "A", "198.51.100.1")
+			provider.seed("shop.example.com", "TXT", ownerTXTValue+"/owner=cluster-b")
+			_, recordSet := reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("198.51.100.1"))
+			Expect(recordSet.Status.Failures).To(HaveLen(1))
+		})
+
+		It("should remove records written with the owner ID", func() {
+			managerConfig.Spec.OwnerID = "cluster-a"
+			reconcileIngress()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			Expect(reconciler.Delete(ctx, ingress)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(provider.records).To(BeEmpty())
+		})
+
+		It("should read sources from the namespace of the Ingress", func() {
+			managerConfig.Spec.NamespaceLocalSources = true
+			ingress.Annotations = map[string]string{typeAnnotationKey: dnsapi.ProviderCloudflare, sourceAnnotationKey: "cloudflare"}
+			objects = append(objects, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloudflare", Namespace: namespace},
+				Data:       map[string][]byte{"zoneid": []byte("zone"), "token": []byte("team-token")},
+			})
+			_, recordSet := reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(recordSet.Status.Records[0].Source).To(Equal(namespace + "/cloudflare"))
+		})
+
+		It("should only read sources of shared namespaces", func() {
+			ingress.Annotations = map[string]string{typeAnnotationKey: dnsapi.ProviderCloudflare, sourceAnnotationKey: "dns/cloudflare"}
+			objects = append(objects, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloudflare", Namespace: "dns"},
+				Data:       map[string][]byte{"zoneid": []byte("zone"), "token": []byte("shared-token")},
+			})
+			_, recordSet := reconcileIngress()
+
+			Expect(provider.records).To(BeEmpty())
+			Expect(recordSet.Status.Failures).To(HaveLen(1))
+			Expect(recordSet.Status.Failures[0].Permanent).To(BeTrue())
+
+			managerConfig.Spec.SharedSourceNamespaces = []string{"dns"}
+			reconciler = nil
+			reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		})
+
+		It("should only publish the included domains", func() {
+			managerConfig.Spec.IncludeDomains = []string{"example.com"}
+			ingress.Spec.Rules = append(ingress.Spec.Rules, k8snetworkingv1.IngressRule{Host: "shop.example.org"})
+			reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("shop.example.org", "A")).To(BeEmpty())
+		})
+
+		It("should filter hostnames with wildcards and regular expressions", func() {
+			managerConfig.Spec.ExcludeDomains = []string{"*.internal.example.com"}
+			managerConfig.Spec.ExcludePatterns = []string{`^staging-`}
+			managerConfig.Spec.IncludeDomains = []string{"*.example.com"}
+			managerConfig.Spec.IncludePatterns = []string{`\.example\.(net|org)$`}
+			ingress.Spec.Rules = append(ingress.Spec.Rules,
+				k8snetworkingv1.IngressRule{Host: "internal.example.com"},
+				k8snetworkingv1.IngressRule{Host: "db.internal.example.com"},
+				k8snetworkingv1.IngressRule{Host: "staging-shop.example.com"},
+				k8snetworkingv1.IngressRule{Host: "Shop.Example.org"},
+				k8snetworkingv1.IngressRule{Host: "example.com"},
+				k8snetworkingv1.IngressRule{Host: "shop.example.io"},
+			)
+			reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("internal.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("Shop.Example.org", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("db.internal.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("staging-shop.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("example.com", "A")).To(BeEmpty())
+			Expect(provider.content("shop.example.io", "A")).To(BeEmpty())
+		})
+
+		It("should leave records alone once their hostname is excluded", func() {
+			reconcileIngress()
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(managerConfig), managerConfig)).To(Succeed())
+			managerConfig.Spec.ExcludePatterns = []string{`^shop\.`}
+			Expect(reconciler.Update(ctx, managerConfig)).To(Succeed())
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			Expect(reconciler.Delete(ctx, ingress)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		})
+
+		It("should limit the hostnames of an Ingress", func() {
+			managerConfig.Spec.Limits.MaxHostsPerSource = 1
+			ingress.Spec.Rules = append(ingress.Spec.Rules, k8snetworkingv1.IngressRule{Host: "store.example.com"})
+			_, recordSet := reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("store.example.com", "A")).To(BeEmpty())
+			Expect(recordSet.Status.Failures).To(HaveLen(1))
+			Expect(recordSet.Status.Failures[0].Permanent).To(BeTrue())
+		})
+
+		It("should postpone deletions beyond the limit", func() {
+			managerConfig.Spec.Limits.MaxDeletionsPerReconcile = 1
+			ingress.Spec.Rules = append(ingress.Spec.Rules, k8snetworkingv1.IngressRule{Host: "store.example.com"})
+			reconcileIngress()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Spec.Rules = []k8snetworkingv1.IngressRule{{Host: "cart.example.com"}}
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+			result, recordSet := reconcileIngress()
+
+			remaining := len(provider.content("shop.example.com", "A")) + len(provider.content("store.example.com", "A"))
+			Expect(remaining).To(Equal(1))
+			Expect(recordSet.Status.Records).To(HaveLen(2))
+			Expect(recordSet.Status.Failures).To(HaveLen(1))
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			reconcileIngress()
+			Expect(provider.content("shop.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("store.example.com", "A")).To(BeEmpty())
+		})
+
+		It("should resync after the resync interval", func() {
+			managerConfig.Spec.ResyncInterval = &metav1.Duration{Duration: 10 * time.Minute}
+			result, _ := reconcileIngress()
+
+			Expect(result.RequeueAfter).To(Equal(10 * time.Minute))
+		})
+
+		It("should fall back to the deprecated ConfigMap", func() {
+			managerConfig = nil
+			ingress.Annotations = map[string]string{clusterProviderAnnotationKey: "cloudflare"}
+			ingress.Spec.Rules = append(ingress.Spec.Rules, k8snetworkingv1.IngressRule{Host: "internal.example.com"})
+			objects = append(objects, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+				Data:       map[string]string{"excludeDomains": "- internal.example.com\n"},
+			})
+			reconciler = newTestReconciler("kube-system", provider, append(objects, ingress)...)
+			reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("internal.example.com", "A")).To(BeEmpty())
+		})
+	})
+})
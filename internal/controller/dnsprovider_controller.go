@@ -0,0 +1,188 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+const (
+	// providerValidationInterval is how often valid credentials are checked again.
+	providerValidationInterval = time.Hour
+
+	// Reasons of the Ready condition of DNSProviders and ClusterDNSProviders
+	reasonCredentialsValid      = "CredentialsValid"
+	reasonInvalidCredentials    = "InvalidCredentials"
+	reasonInvalidConfiguration  = "InvalidConfiguration"
+	reasonValidationFailed      = "ValidationFailed"
+	reasonConfigurationAccepted = "Configured"
+)
+
+// DNSProviderReconciler reconciles a DNSProvider object
+type DNSProviderReconciler struct {
+	client.Client
+	Scheme             *runtime.Scheme
+	ConfigMapName      string
+	ConfigMapNamespace string
+
+	NewProvider ProviderFactory
+}
+
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsproviders,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsproviders/status,verbs=get;update;patch
+
+// writer returns the recordWriter that checks the configuration of a DNSProvider.
+func (r *DNSProviderReconciler) writer() *recordWriter {
+	return &recordWriter{
+		Client:             r.Client,
+		ConfigMapName:      r.ConfigMapName,
+		ConfigMapNamespace: r.ConfigMapNamespace,
+		NewProvider:        r.NewProvider,
+	}
+}
+
+// Reconcile validates the credentials of a DNSProvider and reports the result in its Ready condition.
+func (r *DNSProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var dnsProvider dnsv1.DNSProvider
+	if err := r.Get(ctx, req.NamespacedName, &dnsProvider); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	condition, err := r.writer().validateProvider(ctx, dnsProvider.Spec, dnsProvider.Namespace)
+	condition.ObservedGeneration = dnsProvider.Generation
+	dnsProvider.Status.ObservedGeneration = dnsProvider.Generation
+	meta.SetStatusCondition(&dnsProvider.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, &dnsProvider); err != nil {
+		logger.Error(err, "Failed to update DNSProvider status")
+		return ctrl.Result{}, err
+	}
+
+	return validationResult(ctx, condition, err)
+}
+
+// validateProvider checks the configuration and credentials of a provider spec and returns its
+// Ready condition. Errors that may go away by retrying are returned as well. Secrets are read
+// as described for specConfig.
+func (w *recordWriter) validateProvider(ctx context.Context, spec dnsv1.DNSProviderSpec, namespace string) (metav1.Condition, error) {
+
+	condition := metav1.Condition{Type: dnsv1.ConditionReady, Status: metav1.ConditionFalse}
+
+	ptype, dnsconfig, err := w.specConfig(ctx, spec, namespace)
+	var provider dnsapi.Provider
+	if err == nil {
+		if provider, err = w.newProvider(ptype, dnsconfig); err != nil {
+			err = permanent(err)
+		}
+	}
+	if err != nil {
+		condition.Reason = reasonValidationFailed
+		condition.Message = err.Error()
+		if isPermanent(err) {
+			condition.Reason = reasonInvalidConfiguration
+			return condition, nil
+		}
+		return condition, err
+	}
+
+	verifier, ok := provider.(dnsapi.Verifier)
+	if !ok {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonConfigurationAccepted
+		condition.Message = fmt.Sprintf("The %s provider cannot check its credentials", ptype)
+		return condition, nil
+	}
+
+	if err := verifier.Verify(); err != nil {
+		condition.Message = err.Error()
+		if isPermanent(err) {
+			condition.Reason = reasonInvalidCredentials
+			return condition, nil
+		}
+		condition.Reason = reasonValidationFailed
+		return condition, err
+	}
+
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = reasonCredentialsValid
+	condition.Message = fmt.Sprintf("The %s provider accepted the credentials", ptype)
+	return condition, nil
+}
+
+// validationResult retries a failed validation with the controller's backoff and checks
+// valid credentials again after providerValidationInterval.
+func validationResult(ctx context.Context, condition metav1.Condition, err error) (ctrl.Result, error) {
+
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to validate DNS provider, retrying")
+		return ctrl.Result{}, err
+	}
+	if condition.Status == metav1.ConditionTrue {
+		return ctrl.Result{RequeueAfter: providerValidationInterval}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// providersForSecret maps a Secret to the DNSProviders of its namespace that read it.
+func (r *DNSProviderReconciler) providersForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	var providers dnsv1.DNSProviderList
+	if err := r.List(ctx, &providers, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list DNSProviders")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, dnsProvider := range providers.Items {
+		for _, selector := range providerSecrets(dnsProvider.Spec) {
+			if selector.Name == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&dnsProvider)})
+				break
+			}
+		}
+	}
+
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DNSProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&dnsv1.DNSProvider{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.providersForSecret)).
+		Named("dnsprovider").
+		Complete(r)
+}
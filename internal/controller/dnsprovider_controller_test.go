@@ -0,0 +1,307 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("DNSProvider Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		dnsprovider := &networkingv1.DNSProvider{}
+
+		BeforeEach(func() {
+			requireEnvtest()
+			By("creating the custom resource for the Kind DNSProvider")
+			err := k8sClient.Get(ctx, typeNamespacedName, dnsprovider)
+			if err != nil && errors.IsNotFound(err) {
+				resource := &networkingv1.DNSProvider{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName,
+						Namespace: "default",
+					},
+					Spec: networkingv1.DNSProviderSpec{
+						Cloudflare: &networkingv1.CloudflareProviderSpec{
+							ZoneID:            "zone",
+							APITokenSecretRef: networkingv1.SecretKeySelector{Name: resourceName, Key: "token"},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			if k8sClient == nil {
+				return
+			}
+			resource := &networkingv1.DNSProvider{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cleanup the specific resource instance DNSProvider")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+		It("should successfully reconcile the resource", func() {
+			By("Reconciling the created resource")
+			controllerReconciler := &DNSProviderReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			// The token Secret does not exist, so the validation is retried
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When validating a DNSProvider", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider    *fakeProvider
+			reconciler  *DNSProviderReconciler
+			dnsProvider *networkingv1.DNSProvider
+			token       *corev1.Secret
+		)
+
+		validate := func() (ctrl.Result, *metav1.Condition, error) {
+			reconciler = &DNSProviderReconciler{
+				Client:             newFakeClient(dnsProvider, token),
+				Scheme:             scheme.Scheme,
+				ConfigMapNamespace: "kube-system",
+				NewProvider:        provider.factory,
+			}
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(dnsProvider)})
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(dnsProvider), dnsProvider)).To(Succeed())
+			return result, meta.FindStatusCondition(dnsProvider.Status.Conditions, networkingv1.ConditionReady), err
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			dnsProvider = &networkingv1.DNSProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloudflare", Namespace: namespace, Generation: 2},
+				Spec: networkingv1.DNSProviderSpec{
+					Cloudflare: &networkingv1.CloudflareProviderSpec{
+						ZoneID:            "zone",
+						APITokenSecretRef: networkingv1.SecretKeySelector{Name: "cloudflare-token", Key: "token"},
+						Proxied:           true,
+					},
+					TTL: 300,
+				},
+			}
+			token = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloudflare-token", Namespace: namespace},
+				Data:       map[string][]byte{"token": []byte("secret-token")},
+			}
+		})
+
+		It("should report valid credentials", func() {
+			result, condition, err := validate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(providerValidationInterval))
+
+			Expect(provider.config).To(Equal(map[string]string{"zoneid": "zone", "token": "secret-token", "proxied": "true", "ttl": "300"}))
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal(reasonCredentialsValid))
+			Expect(dnsProvider.Status.ObservedGeneration).To(Equal(int64(2)))
+		})
+
+		It("should report rejected credentials", func() {
+			provider.failing = map[string]error{"example.com": &dnsapi.APIError{Provider: dnsapi.ProviderCloudflare, Code: 403, Message: "Invalid API Token"}}
+
+			_, condition, err := validate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(reasonInvalidCredentials))
+			Expect(condition.Message).To(ContainSubstring("Invalid API Token"))
+		})
+
+		It("should report a missing Secret key as invalid configuration", func() {
+			token.Data = map[string][]byte{"apiToken": []byte("secret-token")}
+
+			_, condition, err := validate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(condition.Reason).To(Equal(reasonInvalidConfiguration))
+		})
+
+		It("should retry when the provider cannot be reached", func() {
+			provider.failing = map[string]error{"example.com": &dnsapi.APIError{Provider: dnsapi.ProviderCloudflare, Code: 503, Transient: true}}
+
+			_, condition, err := validate()
+			Expect(err).To(HaveOccurred())
+			Expect(condition.Reason).To(Equal(reasonValidationFailed))
+		})
+
+		It("should validate DNSProviders again when their Secret changes", func() {
+			validate()
+
+			Expect(reconciler.providersForSecret(ctx, token)).To(ConsistOf(
+				reconcile.Request{NamespacedName: client.ObjectKeyFromObject(dnsProvider)},
+			))
+			other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: namespace}}
+			Expect(reconciler.providersForSecret(ctx, other)).To(BeEmpty())
+		})
+	})
+
+	Context("When publishing with a DNSProvider", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider   *fakeProvider
+			reconciler *IngressReconciler
+			ingress    *k8snetworkingv1.Ingress
+			objects    []client.Object
+		)
+
+		reconcileIngress := func() *networkingv1.DNSRecordSet {
+			if reconciler == nil {
+				reconciler = newTestReconciler("kube-system", provider, append(objects, ingress)...)
+			}
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+
+			var recordSet networkingv1.DNSRecordSet
+			key := types.NamespacedName{Name: "ingress-" + ingress.Name, Namespace: namespace}
+			Expect(reconciler.Get(ctx, key, &recordSet)).To(Succeed())
+			return &recordSet
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			reconciler = nil
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "shop",
+					Namespace:   namespace,
+					Annotations: map[string]string{providerAnnotationKey: "example-com"},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}},
+				},
+			}
+			objects = []client.Object{
+				loadBalancer("traefik", "192.0.2.10"),
+				&networkingv1.DNSProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "example-com", Namespace: namespace},
+					Spec: networkingv1.DNSProviderSpec{
+						RFC2136: &networkingv1.RFC2136ProviderSpec{
+							Server:        "ns1.example.com",
+							Zone:          "example.com",
+							TSIGSecretRef: networkingv1.SecretKeySelector{Name: "tsig", Key: "hmackey"},
+						},
+						Zones: []string{"example.com"},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "tsig", Namespace: namespace},
+					Data:       map[string][]byte{"hmackey": []byte("c2VjcmV0")},
+				},
+			}
+		})
+
+		It("should publish the records with the DNSProvider of the namespace", func() {
+			recordSet := reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.config).To(HaveKeyWithValue("bindServer", "ns1.example.com"))
+			Expect(provider.config).To(HaveKeyWithValue("hmackey", "c2VjcmV0"))
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Records[0].Provider).To(Equal(dnsapi.ProviderBind))
+			Expect(recordSet.Status.Records[0].ProviderKind).To(Equal(networkingv1.KindDNSProvider))
+			Expect(recordSet.Status.Records[0].Source).To(Equal("example-com"))
+		})
+
+		It("should remove records with the DNSProvider they were written with", func() {
+			reconcileIngress()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Spec.Rules = []k8snetworkingv1.IngressRule{{Host: "store.example.com"}}
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+			reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("store.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		})
+
+		It("should not publish hostnames outside the zones of the DNSProvider", func() {
+			ingress.Spec.Rules = append(ingress.Spec.Rules, k8snetworkingv1.IngressRule{Host: "shop.example.org"})
+			recordSet := reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("shop.example.org", "A")).To(BeEmpty())
+			Expect(recordSet.Status.Failures).To(HaveLen(1))
+			Expect(recordSet.Status.Failures[0].Host).To(Equal("shop.example.org"))
+			Expect(recordSet.Status.Failures[0].Permanent).To(BeTrue())
+		})
+
+		It("should publish the records with a ClusterDNSProvider", func() {
+			ingress.Annotations = map[string]string{clusterProviderAnnotationKey: "cloudflare"}
+			objects = append(objects,
+				&networkingv1.ClusterDNSProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "cloudflare"},
+					Spec: networkingv1.DNSProviderSpec{
+						Cloudflare: &networkingv1.CloudflareProviderSpec{
+							ZoneID:            "zone",
+							APITokenSecretRef: networkingv1.SecretKeySelector{Name: "cloudflare-token", Key: "token"},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "cloudflare-token", Namespace: "kube-system"},
+					Data:       map[string][]byte{"token": []byte("secret-token")},
+				},
+			)
+			recordSet := reconcileIngress()
+
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.config).To(HaveKeyWithValue("token", "secret-token"))
+			Expect(recordSet.Status.Records[0].ProviderKind).To(Equal(networkingv1.KindClusterDNSProvider))
+		})
+	})
+})
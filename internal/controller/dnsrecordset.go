@@ -0,0 +1,201 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// previousDomainsKey is the annotation older versions used to remember published hostnames.
+// It is only read to migrate those objects to a DNSRecordSet.
+const previousDomainsKey = "dns.configuration/previous-domains"
+
+// recordSetName returns the name of the DNSRecordSet that belongs to an object.
+// The kind is part of the name, so objects of different kinds can share a name.
+func recordSetName(kind string, name string) string {
+	return strings.ToLower(kind) + "-" + name
+}
+
+// getRecordSet returns the DNSRecordSet of an object, or nil if there is none yet.
+func getRecordSet(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner client.Object) (*dnsv1.DNSRecordSet, error) {
+
+	gvk, err := apiutil.GVKForObject(owner, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	var recordSet dnsv1.DNSRecordSet
+	key := client.ObjectKey{Namespace: owner.GetNamespace(), Name: recordSetName(gvk.Kind, owner.GetName())}
+	if err := c.Get(ctx, key, &recordSet); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Older versions stored the hostnames as declared, so they are compared like the current ones
+	for i := range recordSet.Status.Records {
+		recordSet.Status.Records[i].Host = normalizeHost(recordSet.Status.Records[i].Host)
+	}
+	for i := range recordSet.Status.Failures {
+		recordSet.Status.Failures[i].Host = normalizeHost(recordSet.Status.Failures[i].Host)
+	}
+
+	return &recordSet, nil
+}
+
+// saveRecordSet stores the status of an object's DNSRecordSet, creating the DNSRecordSet with
+// an owner reference on first use so it is garbage collected with the object. Conditions are
+// merged into the existing ones, so their transition times only change with their status.
+func saveRecordSet(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner client.Object, status dnsv1.DNSRecordSetStatus) error {
+
+	gvk, err := apiutil.GVKForObject(owner, scheme)
+	if err != nil {
+		return err
+	}
+
+	recordSet, err := getRecordSet(ctx, c, scheme, owner)
+	if err != nil {
+		return err
+	}
+
+	if recordSet == nil {
+		recordSet = &dnsv1.DNSRecordSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      recordSetName(gvk.Kind, owner.GetName()),
+				Namespace: owner.GetNamespace(),
+			},
+			Spec: dnsv1.DNSRecordSetSpec{
+				SourceRef: dnsv1.SourceReference{
+					APIVersion: gvk.GroupVersion().String(),
+					Kind:       gvk.Kind,
+					Name:       owner.GetName(),
+				},
+			},
+		}
+		if err := controllerutil.SetControllerReference(owner, recordSet, scheme); err != nil {
+			return err
+		}
+		if err := c.Create(ctx, recordSet); err != nil {
+			return err
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(recordSet), recordSet); err != nil {
+			return err
+		}
+		conditions := recordSet.Status.Conditions
+		for _, condition := range status.Conditions {
+			meta.SetStatusCondition(&conditions, condition)
+		}
+		recordSet.Status = status
+		recordSet.Status.Conditions = conditions
+		return c.Status().Update(ctx, recordSet)
+	})
+}
+
+// findRecord returns the managed record for a host.
+func findRecord(records []dnsv1.ManagedRecord, host string) (dnsv1.ManagedRecord, bool) {
+
+	for _, record := range records {
+		if record.Host == host {
+			return record, true
+		}
+	}
+
+	return dnsv1.ManagedRecord{}, false
+}
+
+// findTypedRecord returns the managed record of a type for a host.
+func findTypedRecord(records []dnsv1.ManagedRecord, host string, recordType string) (dnsv1.ManagedRecord, bool) {
+
+	for _, record := range records {
+		if record.Host == host && record.Type == recordType {
+			return record, true
+		}
+	}
+
+	return dnsv1.ManagedRecord{}, false
+}
+
+// summarizeStatus fills in the per-host states and the Ready condition from the records,
+// failures and conflicts of a status.
+func summarizeStatus(status *dnsv1.DNSRecordSetStatus, excluded []string) {
+
+	hosts := map[string]dnsv1.HostStatus{}
+	for _, record := range status.Records {
+		target := record.Target
+		if host, found := hosts[record.Host]; found && host.Provider == record.Provider && host.Target != record.Target {
+			// Dual-stack hosts have an A and an AAAA record
+			target = host.Target + "," + record.Target
+		}
+		hosts[record.Host] = dnsv1.HostStatus{Host: record.Host, State: dnsv1.HostStatePublished, Target: target, Provider: record.Provider}
+	}
+	for _, conflict := range status.Conflicts {
+		hosts[conflict.Host] = dnsv1.HostStatus{Host: conflict.Host, State: dnsv1.HostStateConflict, Message: "published by " + conflict.Owner}
+	}
+	for _, failure := range status.Failures {
+		host := hosts[failure.Host]
+		host.Host, host.State, host.Message = failure.Host, dnsv1.HostStateFailed, failure.Message
+		if failure.Provider != "" {
+			host.Message = failure.Provider + ": " + failure.Message
+		}
+		hosts[failure.Host] = host
+	}
+	for _, domain := range excluded {
+		hosts[domain] = dnsv1.HostStatus{Host: domain, State: dnsv1.HostStateExcluded}
+	}
+
+	status.Hosts = nil
+	for _, host := range hosts {
+		status.Hosts = append(status.Hosts, host)
+	}
+	sort.Slice(status.Hosts, func(i, j int) bool {
+		return status.Hosts[i].Host < status.Hosts[j].Host
+	})
+
+	ready := metav1.Condition{
+		Type:    dnsv1.ConditionReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Published",
+		Message: fmt.Sprintf("%d hosts published", len(status.Records)),
+	}
+	switch {
+	case len(status.Failures) > 0:
+		ready.Status, ready.Reason = metav1.ConditionFalse, "HostsFailed"
+		ready.Message = fmt.Sprintf("%d hosts failed", len(status.Failures))
+	case len(status.Conflicts) > 0:
+		ready.Status, ready.Reason = metav1.ConditionFalse, "HostConflict"
+		ready.Message = fmt.Sprintf("%d hosts are published by another object", len(status.Conflicts))
+	}
+	status.Conditions = []metav1.Condition{ready}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// Reasons of the Events emitted on the objects DNS records are published for.
+const (
+	reasonRecordCreated  = "RecordCreated"
+	reasonRecordUpdated  = "RecordUpdated"
+	reasonRecordAdopted  = "RecordAdopted"
+	reasonRecordDeleted  = "RecordDeleted"
+	reasonRecordRetained = "RecordRetained"
+
+	reasonDomainExcluded    = "DomainExcluded"
+	reasonMissingAnnotation = "MissingAnnotation"
+	reasonUnknownProvider   = "UnknownProvider"
+	reasonRecordNotOwned    = "RecordNotOwned"
+	reasonHostConflict      = "HostConflict"
+	reasonProviderError     = "ProviderError"
+	reasonUnsupportedHost   = "UnsupportedHost"
+	reasonHostnameTemplate  = "HostnameTemplateFailed"
+	reasonInvalidTargets    = "InvalidTargets"
+)
+
+// recordEvent emits an Event on an object if the writer has a recorder.
+func (w *recordWriter) recordEvent(obj runtime.Object, eventtype string, reason string, note string, args ...interface{}) {
+
+	if w.Recorder == nil {
+		return
+	}
+
+	w.Recorder.Eventf(obj, nil, eventtype, reason, "Reconcile", note, args...)
+}
+
+// hostFailed emits a Warning Event for a failed host and records the failure.
+func (w *recordWriter) hostFailed(obj runtime.Object, previous []dnsv1.HostFailure, host string, err error) dnsv1.HostFailure {
+
+	failure := newHostFailure(previous, host, err)
+	w.recordEvent(obj, corev1.EventTypeWarning, reasonProviderError, "DNS records for %s failed (attempt %d): %s", host, failure.Attempts, failure.Message)
+
+	return failure
+}
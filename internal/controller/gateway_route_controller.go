@@ -0,0 +1,273 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;grpcroutes;tlsroutes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes/finalizers;grpcroutes/finalizers;tlsroutes/finalizers,verbs=update
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+
+// GatewayRouteReconciler publishes the hostnames of Gateway API HTTPRoutes, GRPCRoutes and
+// TLSRoutes. The records point to the addresses of the Gateways that accepted the route.
+type GatewayRouteReconciler struct {
+	client.Client
+	Scheme             *runtime.Scheme
+	ConfigMapName      string
+	ConfigMapNamespace string
+	Recorder           events.EventRecorder
+
+	NewProvider ProviderFactory
+
+	// Scope is the scope of the IngressReconciler. Ingresses outside it own no hostnames.
+	Scope IngressScope
+}
+
+// routeSource is a hostSource for one kind of Gateway API route.
+type routeSource struct {
+	name      string
+	object    func() client.Object
+	list      func() client.ObjectList
+	routeSpec func(obj client.Object) (gatewayv1.CommonRouteSpec, []gatewayv1.Hostname, gatewayv1.RouteStatus)
+}
+
+var (
+	httpRouteSource = &routeSource{
+		name:   "HTTPRoute",
+		object: func() client.Object { return &gatewayv1.HTTPRoute{} },
+		list:   func() client.ObjectList { return &gatewayv1.HTTPRouteList{} },
+		routeSpec: func(obj client.Object) (gatewayv1.CommonRouteSpec, []gatewayv1.Hostname, gatewayv1.RouteStatus) {
+			route := obj.(*gatewayv1.HTTPRoute)
+			return route.Spec.CommonRouteSpec, route.Spec.Hostnames, route.Status.RouteStatus
+		},
+	}
+	grpcRouteSource = &routeSource{
+		name:   "GRPCRoute",
+		object: func() client.Object { return &gatewayv1.GRPCRoute{} },
+		list:   func() client.ObjectList { return &gatewayv1.GRPCRouteList{} },
+		routeSpec: func(obj client.Object) (gatewayv1.CommonRouteSpec, []gatewayv1.Hostname, gatewayv1.RouteStatus) {
+			route := obj.(*gatewayv1.GRPCRoute)
+			return route.Spec.CommonRouteSpec, route.Spec.Hostnames, route.Status.RouteStatus
+		},
+	}
+	tlsRouteSource = &routeSource{
+		name:   "TLSRoute",
+		object: func() client.Object { return &gatewayv1.TLSRoute{} },
+		list:   func() client.ObjectList { return &gatewayv1.TLSRouteList{} },
+		routeSpec: func(obj client.Object) (gatewayv1.CommonRouteSpec, []gatewayv1.Hostname, gatewayv1.RouteStatus) {
+			route := obj.(*gatewayv1.TLSRoute)
+			return route.Spec.CommonRouteSpec, route.Spec.Hostnames, route.Status.RouteStatus
+		},
+	}
+)
+
+func (s *routeSource) kind() string               { return s.name }
+func (s *routeSource) newObject() client.Object   { return s.object() }
+func (s *routeSource) newList() client.ObjectList { return s.list() }
+
+// hosts returns the hostnames of a route. Wildcard hostnames are published as wildcard
+// records if the provider supports them.
+func (s *routeSource) hosts(obj client.Object) []string {
+
+	_, hostnames, _ := s.routeSpec(obj)
+
+	var hosts []string
+	for _, hostname := range hostnames {
+		hosts = append(hosts, string(hostname))
+	}
+
+	return normalizeHosts(hosts)
+}
+
+// targets returns the IP addresses of the Gateways that accepted the route. IPv4 addresses
+// are published as A records; AAAA records are only published if there are none.
+func (s *routeSource) targets(ctx context.Context, c client.Reader, obj client.Object, cfg operatorConfig) (string, []string, error) {
+
+	spec, _, status := s.routeSpec(obj)
+
+	var addresses []string
+	var accepted bool
+	for _, parent := range spec.ParentRefs {
+		key, ok := gatewayKey(obj.GetNamespace(), parent)
+		if !ok || !routeAccepted(obj.GetNamespace(), status, key) {
+			continue
+		}
+		accepted = true
+
+		var gateway gatewayv1.Gateway
+		if err := c.Get(ctx, key, &gateway); err != nil {
+			return "", nil, fmt.Errorf("failed to get Gateway %s: %w", key, err)
+		}
+		for _, address := range gateway.Status.Addresses {
+			if address.Type != nil && *address.Type != gatewayv1.IPAddressType {
+				log.FromContext(ctx).Info("Skipping Gateway address that is not an IP address", "gateway", key.String(), "address", address.Value)
+				continue
+			}
+			if !containsString(addresses, address.Value) {
+				addresses = append(addresses, address.Value)
+			}
+		}
+	}
+
+	if !accepted {
+		return "", nil, fmt.Errorf("the %s is not accepted by any Gateway", s.name)
+	}
+
+	return addressTargets(addresses)
+}
+
+// gatewayKey returns the Gateway a parent reference of a route in namespace selects, and false
+// if it selects something else.
+func gatewayKey(namespace string, parent gatewayv1.ParentReference) (client.ObjectKey, bool) {
+
+	if parent.Group != nil && *parent.Group != gatewayv1.GroupName {
+		return client.ObjectKey{}, false
+	}
+	if parent.Kind != nil && *parent.Kind != "Gateway" {
+		return client.ObjectKey{}, false
+	}
+	if parent.Namespace != nil {
+		namespace = string(*parent.Namespace)
+	}
+
+	return client.ObjectKey{Namespace: namespace, Name: string(parent.Name)}, true
+}
+
+// routeAccepted reports whether the route status says the Gateway accepted the route.
+func routeAccepted(namespace string, status gatewayv1.RouteStatus, gateway client.ObjectKey) bool {
+
+	for _, parent := range status.Parents {
+		if key, ok := gatewayKey(namespace, parent.ParentRef); !ok || key != gateway {
+			continue
+		}
+		if meta.IsStatusConditionTrue(parent.Conditions, string(gatewayv1.RouteConditionAccepted)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addressTargets returns the record type and targets for IP addresses: the IPv4 addresses if
+// there are any, else the IPv6 addresses.
+func addressTargets(addresses []string) (string, []string, error) {
+
+	var ipv4, ipv6 []string
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		switch {
+		case ip == nil:
+			continue
+		case ip.To4() != nil:
+			ipv4 = append(ipv4, address)
+		default:
+			ipv6 = append(ipv6, address)
+		}
+	}
+
+	switch {
+	case len(ipv4) > 0:
+		return "A", ipv4, nil
+	case len(ipv6) > 0:
+		return "AAAA", ipv6, nil
+	default:
+		return "", nil, fmt.Errorf("no IP address found")
+	}
+}
+
+// SetupWithManager sets up a controller for each route kind whose resources are installed.
+func (r *GatewayRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	logger := mgr.GetLogger().WithName("gateway-routes")
+
+	for _, source := range []*routeSource{httpRouteSource, grpcRouteSource, tlsRouteSource} {
+		installed, err := sourceInstalled(mgr, source.newObject())
+		if err != nil {
+			return err
+		}
+		if !installed {
+			logger.Info("Gateway API resources not installed, not watching them", "kind", source.kind())
+			continue
+		}
+
+		reconciler := &sourceReconciler{
+			Client:             r.Client,
+			Scheme:             r.Scheme,
+			ConfigMapName:      r.ConfigMapName,
+			ConfigMapNamespace: r.ConfigMapNamespace,
+			Recorder:           r.Recorder,
+			NewProvider:        r.NewProvider,
+			Scope:              r.Scope,
+			source:             source,
+		}
+		b, err := reconciler.builder(mgr)
+		if err != nil {
+			return err
+		}
+
+		// Routes follow the addresses of their Gateways
+		b = b.Watches(&gatewayv1.Gateway{}, handler.EnqueueRequestsFromMapFunc(reconciler.routesForGateway))
+		if err := b.Complete(reconciler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// routesForGateway maps a Gateway to the routes of the reconciler's kind that reference it.
+func (r *sourceReconciler) routesForGateway(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	source, ok := r.source.(*routeSource)
+	if !ok {
+		return nil
+	}
+
+	list := source.newList()
+	if err := r.List(ctx, list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list routes", "kind", source.kind())
+		return nil
+	}
+	items, _ := meta.ExtractList(list)
+
+	var requests []reconcile.Request
+	for _, item := range items {
+		route := item.(client.Object)
+		spec, _, _ := source.routeSpec(route)
+		for _, parent := range spec.ParentRefs {
+			if key, ok := gatewayKey(route.GetNamespace(), parent); ok && key == client.ObjectKeyFromObject(obj) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(route)})
+				break
+			}
+		}
+	}
+
+	return requests
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("Gateway API routes", func() {
+	const namespace = "shop"
+
+	ctx := context.Background()
+
+	var (
+		provider *fakeProvider
+		c        client.Client
+		route    *gatewayv1.HTTPRoute
+		gateway  *gatewayv1.Gateway
+		objects  []client.Object
+	)
+
+	reconcilerFor := func(source hostSource) *sourceReconciler {
+		if c == nil {
+			c = newFakeClient(append(objects, route, gateway)...)
+		}
+		reconciler := newTestSourceReconciler(source, "kube-system", provider)
+		reconciler.Client = c
+		return reconciler
+	}
+
+	reconcileObject := func(source hostSource, obj client.Object) {
+		_, err := reconcilerFor(source).Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	recordSet := func(name string) *networkingv1.DNSRecordSet {
+		var recordSet networkingv1.DNSRecordSet
+		Expect(c.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, &recordSet)).To(Succeed())
+		return &recordSet
+	}
+
+	accepted := func(gatewayName string) gatewayv1.RouteStatus {
+		return gatewayv1.RouteStatus{Parents: []gatewayv1.RouteParentStatus{{
+			ParentRef:      gatewayv1.ParentReference{Name: gatewayv1.ObjectName(gatewayName)},
+			ControllerName: "example.com/gateway",
+			Conditions: []metav1.Condition{{
+				Type:               string(gatewayv1.RouteConditionAccepted),
+				Status:             metav1.ConditionTrue,
+				Reason:             string(gatewayv1.RouteReasonAccepted),
+				LastTransitionTime: metav1.Now(),
+			}},
+		}}}
+	}
+
+	BeforeEach(func() {
+		provider = &fakeProvider{}
+		c = nil
+		route = &gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "web",
+				Namespace:         namespace,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+				Annotations: map[string]string{
+					typeAnnotationKey:   dnsapi.ProviderCloudflare,
+					sourceAnnotationKey: "cloudflare-config",
+				},
+			},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "public"}},
+				},
+				Hostnames: []gatewayv1.Hostname{"shop.example.com"},
+			},
+			Status: gatewayv1.HTTPRouteStatus{RouteStatus: accepted("public")},
+		}
+		ipv6 := gatewayv1.IPAddressType
+		hostname := gatewayv1.HostnameAddressType
+		gateway = &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: namespace},
+			Spec:       gatewayv1.GatewaySpec{GatewayClassName: "example"},
+			Status: gatewayv1.GatewayStatus{
+				Addresses: []gatewayv1.GatewayStatusAddress{
+					{Value: "192.0.2.20"},
+					{Type: &ipv6, Value: "2001:db8::20"},
+					{Type: &hostname, Value: "lb.example.net"},
+				},
+			},
+		}
+		objects = []client.Object{
+			cloudflareSource("cloudflare-config", "kube-system"),
+		}
+	})
+
+	It("should publish the hostnames of an HTTPRoute with the Gateway addresses", func() {
+		route.Spec.Hostnames = append(route.Spec.Hostnames, "*.shop.example.com")
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.20"))
+		Expect(provider.content("shop.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+		Expect(provider.content("*.shop.example.com", "A")).To(ConsistOf("192.0.2.20"))
+
+		records := recordSet("httproute-web").Status.Records
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].Target).To(Equal("192.0.2.20"))
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(route), route)).To(Succeed())
+		Expect(route.Finalizers).To(ContainElement(cleanupFinalizer))
+	})
+
+	It("should fail wildcard hostnames for providers without wildcard records", func() {
+		provider.noWildcards = true
+		route.Spec.Hostnames = append(route.Spec.Hostnames, "*.shop.example.com")
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.20"))
+		Expect(provider.content("*.shop.example.com", "A")).To(BeEmpty())
+		failures := recordSet("httproute-web").Status.Failures
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0].Host).To(Equal("*.shop.example.com"))
+		Expect(failures[0].Permanent).To(BeTrue())
+	})
+
+	It("should publish AAAA records for Gateways with only IPv6 addresses", func() {
+		gateway.Status.Addresses = gateway.Status.Addresses[1:]
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.content("shop.example.com", "AAAA")).To(ConsistOf("2001:db8::20"))
+	})
+
+	It("should wait until a Gateway accepts the route", func() {
+		route.Status.Parents = nil
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.records).To(BeEmpty())
+		failures := recordSet("httproute-web").Status.Failures
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0].Permanent).To(BeFalse())
+	})
+
+	It("should not manage routes without DNS annotations", func() {
+		route.Annotations = nil
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(route), route)).To(Succeed())
+		Expect(route.Finalizers).To(BeEmpty())
+	})
+
+	It("should apply the domain filters", func() {
+		objects = append(objects, &networkingv1.DNSManagerConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+			Spec:       networkingv1.DNSManagerConfigSpec{ExcludeDomains: []string{"shop.example.com"}},
+		})
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.records).To(BeEmpty())
+	})
+
+	It("should leave hostnames to Ingresses", func() {
+		objects = append(objects, &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other", Annotations: route.Annotations},
+			Spec:       k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}}},
+		})
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(recordSet("httproute-web").Status.Conflicts).To(ConsistOf(networkingv1.HostConflict{Host: "shop.example.com", Owner: "other/web"}))
+	})
+
+	It("should not leave hostnames to Ingresses outside the scope", func() {
+		className := "nginx"
+		objects = append(objects, &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "web",
+				Namespace:         "other",
+				Annotations:       route.Annotations,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+			},
+			Spec: k8snetworkingv1.IngressSpec{
+				IngressClassName: &className,
+				Rules:            []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}},
+			},
+		})
+		reconciler := reconcilerFor(httpRouteSource)
+		var err error
+		reconciler.Scope, err = ParseIngressScope("traefik", "", "")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(route)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.20"))
+		Expect(recordSet("httproute-web").Status.Conflicts).To(BeEmpty())
+	})
+
+	It("should publish a hostname for the oldest route only", func() {
+		grpcRoute := &gatewayv1.GRPCRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: namespace, CreationTimestamp: metav1.Now(), Annotations: route.Annotations},
+			Spec: gatewayv1.GRPCRouteSpec{
+				CommonRouteSpec: route.Spec.CommonRouteSpec,
+				Hostnames:       []gatewayv1.Hostname{"shop.example.com"},
+			},
+			Status: gatewayv1.GRPCRouteStatus{RouteStatus: accepted("public")},
+		}
+		objects = append(objects, grpcRoute)
+		reconcileObject(grpcRouteSource, grpcRoute)
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(recordSet("grpcroute-api").Status.Conflicts).To(ConsistOf(networkingv1.HostConflict{Host: "shop.example.com", Owner: "shop/web", Kind: "HTTPRoute"}))
+	})
+
+	It("should remove the records when the route is deleted", func() {
+		reconcileObject(httpRouteSource, route)
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(route), route)).To(Succeed())
+		Expect(c.Delete(ctx, route)).To(Succeed())
+		reconcileObject(httpRouteSource, route)
+
+		Expect(provider.records).To(BeEmpty())
+	})
+
+	It("should hand the records of a deleted Ingress over to a route", func() {
+		ingress := &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "web",
+				Namespace:         namespace,
+				Annotations:       route.Annotations,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+			},
+			Spec: k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}}},
+		}
+		objects = append(objects, ingress, loadBalancer("traefik", "192.0.2.10"))
+		ingressReconciler := newTestReconciler("kube-system", provider)
+		ingressReconciler.Client = reconcilerFor(httpRouteSource).Client
+
+		_, err := ingressReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+		Expect(c.Delete(ctx, ingress)).To(Succeed())
+		_, err = ingressReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provider.content("shop.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+
+		reconcileObject(httpRouteSource, route)
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.20"))
+		Expect(recordSet("httproute-web").Status.Records).To(HaveLen(1))
+	})
+
+	It("should map a Gateway to the routes that reference it", func() {
+		other := route.DeepCopy()
+		other.Name = "other"
+		other.Spec.ParentRefs = []gatewayv1.ParentReference{{Name: "internal"}}
+		objects = append(objects, other)
+
+		requests := reconcilerFor(httpRouteSource).routesForGateway(ctx, gateway)
+		Expect(requests).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(route)}))
+	})
+})
@@ -0,0 +1,217 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// hostnameTemplateData is what hostname templates are executed with.
+type hostnameTemplateData struct {
+	Name        string
+	Namespace   string
+	Kind        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// hostnameTemplates holds the parsed templates of the hostnameTemplates setting.
+type hostnameTemplates struct {
+	defaultTemplate *template.Template
+	// namespaces maps namespaces to their template, nil if they have generated hostnames off
+	namespaces map[string]*template.Template
+	// generated maps kinds to the objects that get hostnames generated, by hostname. It is
+	// filled on first use, see objectsGenerating, and lives as long as the configuration,
+	// which is loaded for every reconcile.
+	generated map[string]map[string][]client.Object
+}
+
+// parseHostnameTemplates parses the templates of a DNSManagerConfig. It returns nil if no
+// template is set.
+func parseHostnameTemplates(spec *dnsv1.HostnameTemplates) (*hostnameTemplates, error) {
+
+	if spec == nil || spec.Default == "" && len(spec.Namespaces) == 0 {
+		return nil, nil
+	}
+
+	parse := func(name, text string) (*template.Template, error) {
+		if text == "" {
+			return nil, nil
+		}
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostnameTemplates %s: %w", name, err)
+		}
+		return tmpl, nil
+	}
+
+	var err error
+	templates := &hostnameTemplates{namespaces: map[string]*template.Template{}, generated: map[string]map[string][]client.Object{}}
+	if templates.defaultTemplate, err = parse("default", spec.Default); err != nil {
+		return nil, err
+	}
+	for namespace, text := range spec.Namespaces {
+		if templates.namespaces[namespace], err = parse("namespace "+namespace, text); err != nil {
+			return nil, err
+		}
+	}
+
+	return templates, nil
+}
+
+// generatesHosts reports whether the configuration has hostname templates.
+func (c operatorConfig) generatesHosts() bool {
+	return c.hostnameTemplates != nil
+}
+
+// generatedHosts returns the hostnames the template of its namespace generates for an object
+// of a kind. The template may generate several hostnames separated by commas. Hostnames that
+// are no valid DNS names return a permanent error.
+func (c operatorConfig) generatedHosts(obj client.Object, kind string) ([]string, error) {
+
+	if c.hostnameTemplates == nil {
+		return nil, nil
+	}
+	tmpl, found := c.hostnameTemplates.namespaces[obj.GetNamespace()]
+	if !found {
+		tmpl = c.hostnameTemplates.defaultTemplate
+	}
+	if tmpl == nil {
+		return nil, nil
+	}
+
+	var out strings.Builder
+	data := hostnameTemplateData{
+		Name:        obj.GetName(),
+		Namespace:   obj.GetNamespace(),
+		Kind:        kind,
+		Labels:      obj.GetLabels(),
+		Annotations: obj.GetAnnotations(),
+	}
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, permanent(fmt.Errorf("failed to generate hostnames: %w", err))
+	}
+
+	hosts := normalizeHosts(splitList(out.String()))
+	for _, host := range hosts {
+		if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(host, "*.")); len(errs) > 0 {
+			return nil, permanent(fmt.Errorf("generated hostname %q is invalid: %s", host, strings.Join(errs, ", ")))
+		}
+	}
+
+	return hosts, nil
+}
+
+// objectHosts returns the hostnames an object of a kind declares or, if it declares none, the
+// ones generated for it. Generated hostnames that cannot be used are left out.
+func (c operatorConfig) objectHosts(obj client.Object, kind string, declared []string) []string {
+
+	if len(declared) > 0 {
+		return declared
+	}
+	hosts, _ := c.generatedHosts(obj, kind)
+
+	return hosts
+}
+
+// ingressHostnames returns the hostnames an Ingress publishes under the configuration.
+func (c operatorConfig) ingressHostnames(ingress *networkingv1.Ingress) []string {
+	return c.objectHosts(ingress, "Ingress", ingressHosts(ingress, c.IncludeTLSHosts))
+}
+
+// declaredIngressHosts returns the hostnames an Ingress declares under the configuration.
+func (c operatorConfig) declaredIngressHosts(obj client.Object) []string {
+	return ingressHosts(obj.(*networkingv1.Ingress), c.IncludeTLSHosts)
+}
+
+// objectsGenerating returns the objects of list of a kind that declare no hostnames and get
+// host generated. Generated hostnames depend on the configuration and cannot be indexed by
+// the cache, so the objects of a kind are listed and indexed once for the configuration
+// instead of for every hostname.
+func (c operatorConfig) objectsGenerating(ctx context.Context, r client.Reader, list client.ObjectList, kind string, declared func(client.Object) []string, host string) ([]client.Object, error) {
+
+	if c.hostnameTemplates == nil {
+		return nil, nil
+	}
+
+	byHost, found := c.hostnameTemplates.generated[kind]
+	if !found {
+		if err := r.List(ctx, list); err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+
+		byHost = map[string][]client.Object{}
+		for _, item := range items {
+			candidate := item.(client.Object)
+			if len(declared(candidate)) > 0 {
+				continue
+			}
+			generated, _ := c.generatedHosts(candidate, kind)
+			for _, generatedHost := range generated {
+				byHost[generatedHost] = append(byHost[generatedHost], candidate)
+			}
+		}
+		c.hostnameTemplates.generated[kind] = byHost
+	}
+
+	return byHost[host], nil
+}
+
+// objectsGeneratingHosts returns requests for the objects of list of a kind that declare no
+// hostnames and get one of hosts generated, leaving out obj.
+func objectsGeneratingHosts(ctx context.Context, c client.Reader, list client.ObjectList, kind string, declared func(client.Object) []string, hosts []string, obj client.Object, cfg operatorConfig) []reconcile.Request {
+
+	var requests []reconcile.Request
+	seen := map[types.NamespacedName]bool{}
+	if sourceKind(obj) == kind {
+		seen[client.ObjectKeyFromObject(obj)] = true
+	}
+
+	for _, host := range hosts {
+		generated, err := cfg.objectsGenerating(ctx, c, list, kind, declared, host)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list objects for generated hostnames", "kind", kind)
+			return nil
+		}
+		for _, candidate := range generated {
+			key := client.ObjectKeyFromObject(candidate)
+			if !seen[key] {
+				seen[key] = true
+				requests = append(requests, reconcile.Request{NamespacedName: key})
+			}
+		}
+	}
+
+	return requests
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("Hostname templates", func() {
+	const namespace = "shop"
+
+	ctx := context.Background()
+
+	var (
+		provider      *fakeProvider
+		recorder      *events.FakeRecorder
+		reconciler    *IngressReconciler
+		ingress       *k8snetworkingv1.Ingress
+		managerConfig *networkingv1.DNSManagerConfig
+		objects       []client.Object
+	)
+
+	reconcileIngress := func(ingress *k8snetworkingv1.Ingress) *networkingv1.DNSRecordSet {
+		if reconciler == nil {
+			reconciler = newTestReconciler("kube-system", provider, append(objects, ingress, managerConfig)...)
+			reconciler.Recorder = recorder
+		}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+
+		var recordSet networkingv1.DNSRecordSet
+		if err := reconciler.Get(ctx, client.ObjectKey{Name: "ingress-" + ingress.Name, Namespace: ingress.Namespace}, &recordSet); err != nil {
+			return nil
+		}
+		return &recordSet
+	}
+
+	BeforeEach(func() {
+		provider = &fakeProvider{}
+		recorder = events.NewFakeRecorder(20)
+		reconciler = nil
+		ingress = &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: namespace,
+				Labels:    map[string]string{"team": "checkout"},
+				Annotations: map[string]string{
+					typeAnnotationKey:   dnsapi.ProviderCloudflare,
+					sourceAnnotationKey: "cloudflare-config",
+				},
+			},
+			Spec: k8snetworkingv1.IngressSpec{DefaultBackend: &k8snetworkingv1.IngressBackend{}},
+		}
+		managerConfig = &networkingv1.DNSManagerConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+			Spec: networkingv1.DNSManagerConfigSpec{
+				HostnameTemplates: &networkingv1.HostnameTemplates{Default: "{{.Name}}.{{.Namespace}}.apps.example.com"},
+			},
+		}
+		objects = []client.Object{
+			loadBalancer("traefik", "192.0.2.10"),
+			cloudflareSource("cloudflare-config", "kube-system"),
+		}
+	})
+
+	It("should publish generated hostnames of Ingresses without hosts", func() {
+		recordSet := reconcileIngress(ingress)
+
+		Expect(provider.content("web.shop.apps.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(provider.content("web.shop.apps.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+		Expect(recordSet.Status.Records).To(HaveLen(1))
+	})
+
+	It("should leave Ingresses with hosts alone", func() {
+		ingress.Spec.Rules = []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}}
+		reconcileIngress(ingress)
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(provider.content("web.shop.apps.example.com", "A")).To(BeEmpty())
+	})
+
+	It("should prefer the template of the namespace", func() {
+		managerConfig.Spec.HostnameTemplates.Namespaces = map[string]string{
+			namespace: "{{.Name}}-{{index .Labels \"team\"}}.example.com",
+			"other":   "",
+		}
+		reconcileIngress(ingress)
+		Expect(provider.content("web-checkout.example.com", "A")).To(ConsistOf("192.0.2.10"))
+
+		other := ingress.DeepCopy()
+		other.Namespace = "other"
+		reconciler = nil
+		objects = append(objects, ingress)
+		Expect(reconcileIngress(other).Status.Records).To(BeEmpty())
+		Expect(provider.content("web.other.apps.example.com", "A")).To(BeEmpty())
+	})
+
+	It("should filter generated hostnames like declared ones", func() {
+		managerConfig.Spec.ExcludeDomains = []string{"*.shop.apps.example.com"}
+		reconcileIngress(ingress)
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal DomainExcluded")))
+	})
+
+	It("should leave generated hostnames to Ingresses that declare them", func() {
+		owner := &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "legacy",
+				Namespace:         namespace,
+				Annotations:       ingress.Annotations,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+			},
+			Spec: k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "web.shop.apps.example.com"}}},
+		}
+		objects = append(objects, owner)
+		ingress.CreationTimestamp = metav1.Now()
+		recordSet := reconcileIngress(ingress)
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(recordSet.Status.Conflicts).To(ConsistOf(networkingv1.HostConflict{Host: "web.shop.apps.example.com", Owner: "shop/legacy"}))
+		Expect(reconciler.ingressesSharingHosts(ctx, owner)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)}))
+	})
+
+	It("should list the objects once for all generated hostnames", func() {
+		managerConfig.Spec.HostnameTemplates.Default = "{{.Name}}.{{.Namespace}}.apps.example.com, {{.Name}}.{{.Namespace}}.internal.example.com"
+		for _, name := range []string{"api", "admin", "status"} {
+			other := ingress.DeepCopy()
+			other.Name = name
+			objects = append(objects, other)
+		}
+		reconciler = newTestReconciler("kube-system", provider, append(objects, ingress, managerConfig)...)
+		lists := 0
+		reconciler.Client = interceptor.NewClient(reconciler.Client.(client.WithWatch), interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if _, ok := list.(*k8snetworkingv1.IngressList); ok && len(opts) == 0 {
+					lists++
+				}
+				return c.List(ctx, list, opts...)
+			},
+		})
+		reconcileIngress(ingress)
+
+		Expect(provider.content("web.shop.apps.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(provider.content("web.shop.internal.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(lists).To(Equal(1))
+	})
+
+	It("should not publish invalid generated hostnames", func() {
+		managerConfig.Spec.HostnameTemplates.Default = "{{.Name}}.{{index .Labels \"app\"}}.example.com"
+		Expect(reconcileIngress(ingress)).To(BeNil())
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("HostnameTemplateFailed No hostnames are published")))
+	})
+
+	It("should reject invalid templates", func() {
+		_, err := parseManagerConfig(networkingv1.DNSManagerConfigSpec{
+			HostnameTemplates: &networkingv1.HostnameTemplates{Namespaces: map[string]string{namespace: "{{.Name"}},
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid hostnameTemplates namespace shop")))
+	})
+
+	It("should publish generated hostnames of LoadBalancer Services", func() {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "mqtt", Namespace: namespace, Annotations: ingress.Annotations},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.30"}}},
+			},
+		}
+		services := newTestSourceReconciler(serviceHostSource, "kube-system", provider, append(objects, service, managerConfig)...)
+		_, err := services.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(service)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.content("mqtt.shop.apps.example.com", "A")).To(ConsistOf("192.0.2.30"))
+	})
+})
@@ -21,16 +21,23 @@ import (
 	"fmt"
 	"strings"
 
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
 	"github.com/ruedigerp/kube-dns-manager/dnsapi"
-	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // IngressReconciler reconciles a Ingress object
@@ -39,18 +46,66 @@ type IngressReconciler struct {
 	Scheme             *runtime.Scheme
 	ConfigMapName      string
 	ConfigMapNamespace string
+	Recorder           events.EventRecorder
+
+	NewProvider ProviderFactory
+
+	// Scope restricts the Ingresses the reconciler manages. All Ingresses if unset.
+	Scope IngressScope
 }
 
-// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=ingresses/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=ingresses/finalizers,verbs=update
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=services;configmaps;secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsrecordsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnsrecordsets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+const cleanupFinalizer = "kube-dns-manager.io/dns-cleanup"
+
+const (
+	typeAnnotationKey        = "dns.configuration/type"
+	sourceAnnotationKey      = "dns.configuration/source"
+	deletionPolicyAnnotation = "dns.configuration/deletion-policy"
+
+	// providerAnnotationKey names a DNSProvider in the namespace of the Ingress,
+	// clusterProviderAnnotationKey a ClusterDNSProvider. Both replace type and source.
+	providerAnnotationKey        = "dns.configuration/provider"
+	clusterProviderAnnotationKey = "dns.configuration/cluster-provider"
 
-const ingressFinalizer = "kube-dns-manager.io/dns-cleanup"
+	// targetsAnnotationKey lists several providers with their targets instead, e.g. for
+	// split-horizon DNS.
+	targetsAnnotationKey = "dns.configuration/targets"
+
+	// DeletionPolicyDelete removes the A and TXT records when the Ingress is deleted.
+	DeletionPolicyDelete = "delete"
+	// DeletionPolicyRetain keeps the A record and marks the ownership TXT record as orphaned.
+	DeletionPolicyRetain = "retain"
+
+	ownerTXTValue    = "kube-dns-manager"
+	orphanedTXTValue = "kube-dns-manager/orphaned"
+)
+
+// errRecordNotOwned is returned when a record exists that kube-dns-manager did not create.
+var errRecordNotOwned = fmt.Errorf("record exists but is not owned by kube-dns-manager")
+
+// writer returns the recordWriter for the reconciler's configuration.
+func (r *IngressReconciler) writer() *recordWriter {
+	return &recordWriter{
+		Client:             r.Client,
+		ConfigMapName:      r.ConfigMapName,
+		ConfigMapNamespace: r.ConfigMapNamespace,
+		Recorder:           r.Recorder,
+		NewProvider:        r.NewProvider,
+		Scope:              r.Scope,
+	}
+}
 
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.1/pkg/reconcile
 func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
+	w := r.writer()
 
 	// Ingress-Resource laden
 	var ingress networkingv1.Ingress
@@ -63,62 +118,28 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	// Traefik-Konfiguration aus der ConfigMap laden
-	traefikServiceName, traefikNamespace, excludeDomains, err := r.loadTraefikConfig(ctx)
+	// Operator-Konfiguration laden
+	operatorCfg, err := w.loadOperatorConfig(ctx)
 	if err != nil {
 
-		logger.Error(err, "Failed to load Traefik configuration")
+		logger.Error(err, "Failed to load operator configuration")
 		return ctrl.Result{}, err
 	}
 
-	logger.Info(fmt.Sprintf("Using Traefik service: %s/%s", traefikNamespace, traefikServiceName))
-
-	// Handle finalizer logic
-	if ingress.DeletionTimestamp.IsZero() {
+	// Handle cleanup during deletion
+	if !ingress.DeletionTimestamp.IsZero() {
+		if containsString(ingress.Finalizers, cleanupFinalizer) {
 
-		// Add finalizer if not already present
-		if err := r.addFinalizer(ctx, &ingress); err != nil {
-			logger.Error(err, "Failed to add finalizer to ingress")
-			return ctrl.Result{}, err
-		}
+			status, err := r.cleanupRecords(ctx, &ingress, operatorCfg)
+			if err != nil {
+				logger.Error(err, "Failed to load DNSRecordSet")
+				return ctrl.Result{}, err
+			}
 
-	} else {
-		// Handle cleanup during deletion
-		if containsString(ingress.Finalizers, ingressFinalizer) {
-
-			logger.Info("Cleaning up DNS records for deleted Ingress")
-
-			domains := r.extractDomains(&ingress)
-
-			filteredDomains := []string{}
-
-			dnsconfig, _ := r.loadDNSConfiguration(ctx, ingress.Annotations["dns.configuration/source"])
-			for _, domain := range domains {
-
-				if containsString(filteredDomains, domain) {
-					fmt.Printf("Domain %s is included in filteredDomains.\n", domain)
-					continue
-				}
-
-				aexists, id, _ := dnsapi.GetRecordId(dnsconfig["zoneid"], dnsconfig["token"], domain, "A")
-				if aexists {
-					if astate, err := dnsapi.DeleteRecord(dnsconfig["zoneid"], dnsconfig["token"], id); err != nil {
-						logger.Error(err, "Failed to delete A record", "domain", domain)
-						if !astate {
-							fmt.Printf("Record not deleted")
-						}
-					}
-				}
-
-				txtexists, id, _ := dnsapi.GetRecordId(dnsconfig["zoneid"], dnsconfig["token"], domain, "txt")
-				if txtexists {
-					if txtstate, err := dnsapi.DeleteRecord(dnsconfig["zoneid"], dnsconfig["token"], id); err != nil {
-						logger.Error(err, "Failed to delete TXT record", "domain", domain)
-						if !txtstate {
-							fmt.Printf("Record not deleted")
-						}
-					}
-				}
+			// Keep the finalizer until the records are gone or cannot be removed at all
+			if requeue := retryableFailures(status.Failures); len(requeue) > 0 {
+				logger.Info("Cleanup of DNS records failed, retrying", "domains", requeue)
+				return r.saveStatus(ctx, &ingress, status, nil)
 			}
 
 			// Remove the finalizer
@@ -131,177 +152,291 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		}
 		return ctrl.Result{}, nil
 	}
-	// LoadBalancer-IP des Traefik-Service abrufen
-	loadBalancerIP, err := r.getLoadBalancerIP(ctx, traefikNamespace, traefikServiceName)
-	if err != nil {
-		logger.Error(err, "Failed to get LoadBalancer IP")
-		return ctrl.Result{}, err
-	}
 
-	logger.Info(fmt.Sprintf("LoadBalancer IP for Traefik: %s", loadBalancerIP))
+	if !r.Scope.Matches(&ingress) {
+		logger.Info("Ingress is outside the scope of the operator. Skipping...")
+		return ctrl.Result{}, r.releaseIngress(ctx, &ingress)
+	}
 
 	// Annotationen prüfen
-	typeAnnotationKey := "dns.configuration/type"
-	typeAnnotationValue, found := ingress.Annotations[typeAnnotationKey]
+	ref, found, err := operatorCfg.ingressProviderRef(&ingress)
+	if err != nil {
+		logger.Info("Invalid DNS configuration targets annotation. Skipping...", "error", err.Error())
+		w.recordEvent(&ingress, corev1.EventTypeWarning, reasonInvalidTargets, "Annotation %s is invalid, no DNS records are published: %v", targetsAnnotationKey, err)
+		return ctrl.Result{}, r.releaseIngress(ctx, &ingress)
+	}
 	if !found {
-		logger.Info("No DNS configuration type annotation found. Skipping...")
-		return ctrl.Result{}, nil
+		_, hasType := ingress.Annotations[typeAnnotationKey]
+		_, hasSource := ingress.Annotations[sourceAnnotationKey]
+		switch {
+		case hasSource:
+			logger.Info("No DNS configuration type annotation found. Skipping...")
+			w.recordEvent(&ingress, corev1.EventTypeWarning, reasonMissingAnnotation, "Annotation %s is missing, no DNS records are published", typeAnnotationKey)
+		case hasType:
+			logger.Info("No DNS configuration source annotation found. Skipping...")
+			w.recordEvent(&ingress, corev1.EventTypeWarning, reasonMissingAnnotation, "Annotation %s is missing, no DNS records are published", sourceAnnotationKey)
+		default:
+			logger.Info("No DNS configuration annotation found. Skipping...")
+		}
+		return ctrl.Result{}, r.releaseIngress(ctx, &ingress)
 	}
+	logger.Info("DNS provider: ", "provider", refName(ref))
 
-	sourceAnnotationKey := "dns.configuration/source"
-	sourceAnnotationValue, found := ingress.Annotations[sourceAnnotationKey]
-	if !found {
-		logger.Info("No DNS configuration source annotation found. Skipping...")
-		return ctrl.Result{}, nil
+	// Add finalizer if not already present
+	if err := r.addFinalizer(ctx, &ingress); err != nil {
+		logger.Error(err, "Failed to add finalizer to ingress")
+		return ctrl.Result{}, err
 	}
-	logger.Info("Source Annotation: ", "sourceAnnotationValue", sourceAnnotationValue)
 
 	// Extract current domains
-	currentDomains := r.extractDomains(&ingress)
+	currentDomains, err := r.extractDomains(&ingress, operatorCfg)
+	if err != nil {
+		// Records published before are kept until the hostnames can be generated again
+		logger.Error(err, "Failed to generate hostnames")
+		w.recordEvent(&ingress, corev1.EventTypeWarning, reasonHostnameTemplate, "No hostnames are published: %v", err)
+		return ctrl.Result{}, nil
+	}
 
 	// Prüfen, ob die Domänen in der Exclude-Liste sind
-	filteredDomains := []string{}
-	for _, domain := range currentDomains {
-		if !containsString(excludeDomains, domain) {
-			filteredDomains = append(filteredDomains, domain)
-		} else {
-			logger.Info("Domain excluded from processing", "domain", domain)
-		}
-	}
+	filteredDomains, excluded := w.filterHosts(ctx, &ingress, currentDomains)
 
-	// Falls keine Domänen übrig bleiben, abbrechen
 	if len(filteredDomains) == 0 {
-		logger.Info("All domains are excluded. Skipping processing for Ingress")
-		return ctrl.Result{}, nil
+		logger.Info("All domains are excluded for Ingress")
 	}
 
-	// Load previous domains from annotation
-	previousDomainsKey := "dns.configuration/previous-domains"
-
-	var previousDomains []string
-	if val, found := ingress.Annotations[previousDomainsKey]; found {
-		previousDomains = strings.Split(val, ",")
-	} else {
-		previousDomains = []string{}
+	// Hostnames declared by several Ingresses are only published by their owner
+	filteredDomains, conflicts, err := r.resolveConflicts(ctx, &ingress, filteredDomains, operatorCfg)
+	if err != nil {
+		logger.Error(err, "Failed to check for hostname conflicts")
+		return ctrl.Result{}, err
 	}
 
-	removedDomains := difference(previousDomains, currentDomains)
+	// Load the records and failures of earlier reconciles
+	recordSet, err := getRecordSet(ctx, r.Client, r.Scheme, &ingress)
+	if err != nil {
+		logger.Error(err, "Failed to load DNSRecordSet")
+		return ctrl.Result{}, err
+	}
+	previousRecords := r.managedRecords(&ingress, recordSet)
+	var previousFailures []dnsv1.HostFailure
+	if recordSet != nil {
+		previousFailures = recordSet.Status.Failures
+	}
 
-	addDomains := difference(currentDomains, previousDomains)
+	previous := dnsv1.DNSRecordSetStatus{Records: previousRecords, Failures: previousFailures}
 
-	switch typeAnnotationValue {
-	case "bind":
+	var status dnsv1.DNSRecordSetStatus
+	if value, found := ingress.Annotations[targetsAnnotationKey]; found {
+		// ingressProviderRef already parsed the annotation
+		bindings, _ := parseTargetBindings(value)
+		status = r.syncBindings(ctx, &ingress, bindings, filteredDomains, previous, conflicts, operatorCfg)
+	} else {
+		provider, err := r.providerFor(ctx, &ingress, ref, operatorCfg)
+		if err == nil && provider == nil {
+			return ctrl.Result{}, nil
+		}
 
-		logger.Info("Handle domains for BIND", "domains", removedDomains)
-	case "cloudflare":
+		// LoadBalancer-IP des Traefik-Service oder Adressen der Nodes abrufen
+		var recordType string
+		var targets []string
+		if err == nil {
+			recordType, targets, err = ingressTargets(ctx, r.Client, operatorCfg)
+		}
 
-		dnsconfig, _ := r.loadDNSConfiguration(ctx, sourceAnnotationValue)
+		// Without a provider or a target no host can be published; keep what was published before
+		if err != nil {
+			logger.Error(err, "Failed to prepare DNS records")
+			status := dnsv1.DNSRecordSetStatus{Records: previousRecords, Conflicts: conflicts}
+			for _, domain := range filteredDomains {
+				status.Failures = append(status.Failures, w.hostFailed(&ingress, previousFailures, domain, err))
+			}
+			return r.saveStatus(ctx, &ingress, status, excluded)
+		}
 
-		for _, domain := range removedDomains {
+		desired := desiredRecords(filteredDomains, recordType, targets)
+		status = w.syncRecords(ctx, &ingress, provider, desired, previous, conflicts)
+	}
+	result, err := r.saveStatus(ctx, &ingress, status, excluded)
+	if err != nil {
+		return result, err
+	}
+	if result.RequeueAfter == 0 {
+		result.RequeueAfter = operatorCfg.ResyncInterval
+	}
 
-			if containsString(filteredDomains, domain) {
-				fmt.Printf("Domain %s ist in filteredDomains enthalten.\n", domain)
-				continue
-			}
+	// The DNSRecordSet replaces the annotation used by older versions
+	if _, found := ingress.Annotations[previousDomainsKey]; found {
+		patch := client.MergeFrom(ingress.DeepCopy())
+		delete(ingress.Annotations, previousDomainsKey)
+		if err := r.Patch(ctx, &ingress, patch); err != nil {
+			logger.Error(err, "Failed to remove previous-domains annotation")
+			return ctrl.Result{}, err
+		}
+	}
 
-			exists, id, _ := dnsapi.GetRecordId(dnsconfig["zoneid"], dnsconfig["token"], domain, "A")
-			if exists {
-				// logger.Info("DNS Record exists", "id", id)
-				dnsapi.DeleteRecord(dnsconfig["zoneid"], dnsconfig["token"], id)
-			}
+	return result, nil
+}
 
-			txtexists, id, _ := dnsapi.GetRecordId(dnsconfig["zoneid"], dnsconfig["token"], domain, "TXT")
-			if txtexists {
-				dnsapi.DeleteRecord(dnsconfig["zoneid"], dnsconfig["token"], id)
-			} else {
-				fmt.Printf("TXT Record for %s not exists.\n", domain)
-			}
+// saveStatus stores the DNSRecordSet status of an Ingress and requeues it if hosts failed.
+func (r *IngressReconciler) saveStatus(ctx context.Context, ingress *networkingv1.Ingress, status dnsv1.DNSRecordSetStatus, excluded []string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
 
-		}
-	default:
+	status.ObservedGeneration = ingress.Generation
+	summarizeStatus(&status, excluded)
 
-		logger.Info(fmt.Sprintf("Unknown DNS configuration type: %s. Skipping...", typeAnnotationValue))
+	if err := saveRecordSet(ctx, r.Client, r.Scheme, ingress, status); err != nil {
+		logger.Error(err, "Failed to update DNSRecordSet")
+		return ctrl.Result{}, err
+	}
 
+	after := requeueAfter(status.Failures)
+	if after > 0 {
+		logger.Info("Some hosts failed, requeueing", "failures", len(status.Failures), "requeueAfter", after)
 	}
-	// Add records
-	switch typeAnnotationValue {
-	case "bind":
 
-		logger.Info("Handle add domains for BIND", "domains", addDomains)
+	return ctrl.Result{RequeueAfter: after}, nil
+}
 
-	case "cloudflare":
+// cleanupRecords removes or releases the records of a deleted Ingress. It applies the same
+// exclude list, provider selection and ownership checks as the create/update path. The
+// returned status holds the records that could not be cleaned up and why.
+func (r *IngressReconciler) cleanupRecords(ctx context.Context, ingress *networkingv1.Ingress, cfg operatorConfig) (dnsv1.DNSRecordSetStatus, error) {
+	logger := log.FromContext(ctx)
 
-		dnsconfig, err := r.loadDNSConfiguration(ctx, sourceAnnotationValue)
+	policy := deletionPolicy(ctx, ingress, cfg)
+	logger.Info("Cleaning up DNS records for deleted Ingress", "deletionPolicy", policy)
 
-		if err != nil {
-			logger.Info("Fehler beim lesen der Config", "err", err)
-			return ctrl.Result{}, err
+	recordSet, err := getRecordSet(ctx, r.Client, r.Scheme, ingress)
+	if err != nil {
+		return dnsv1.DNSRecordSetStatus{}, err
+	}
+	var previousFailures []dnsv1.HostFailure
+	if recordSet != nil {
+		previousFailures = recordSet.Status.Failures
+	}
+
+	var status dnsv1.DNSRecordSetStatus
+	for _, record := range r.managedRecords(ingress, recordSet) {
+		if cfg.excludes(record.Host) {
+			logger.Info("Domain excluded from processing", "domain", record.Host)
+			continue
+		}
+		if !cfg.deletions.take() {
+			logger.Info("Deletion limit reached, keeping DNS records until the next reconcile", "domain", record.Host)
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, newHostFailure(previousFailures, record.Host, errDeletionLimit))
+			continue
 		}
 
-		for _, domain := range currentDomains {
+		if err := r.cleanupRecord(ctx, ingress, record, policy, cfg); err != nil {
+			logger.Error(err, "Failed to clean up DNS records", "domain", record.Host)
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, r.writer().hostFailed(ingress, previousFailures, record.Host, err))
+		}
+	}
 
-			if !containsString(filteredDomains, domain) {
-				fmt.Printf("Domain %s is included in filteredDomains.\n", domain)
-				continue
-			}
+	return status, nil
+}
 
-			exists, _, _ := dnsapi.GetRecordId(dnsconfig["zoneid"], dnsconfig["token"], domain, "a")
-			if exists {
-				dnsapi.UpdateRecord(dnsconfig["zoneid"], dnsconfig["token"], domain, "A", loadBalancerIP, false)
-			} else {
-				dnsapi.AddRecord(dnsconfig["zoneid"], dnsconfig["token"], domain, "A", loadBalancerIP, false)
-			}
+// cleanupRecord removes or releases the records of one host, unless another Ingress or a
+// route takes it over.
+func (r *IngressReconciler) cleanupRecord(ctx context.Context, ingress *networkingv1.Ingress, record dnsv1.ManagedRecord, policy string, cfg operatorConfig) error {
+	logger := log.FromContext(ctx)
+	w := r.writer().withConfig(cfg)
 
-			txtexists, _, _ := dnsapi.GetRecordId(dnsconfig["zoneid"], dnsconfig["token"], domain, "TXT")
-			if txtexists {
-				dnsapi.UpdateRecord(dnsconfig["zoneid"], dnsconfig["token"], domain, "TXT", "kube-dns-manager", false)
-			} else {
-				dnsapi.AddRecord(dnsconfig["zoneid"], dnsconfig["token"], domain, "TXT", "kube-dns-manager", false)
-			}
-		}
-	default:
-		logger.Info(fmt.Sprintf("Unknown DNS configuration type: %s. Skipping...", typeAnnotationValue))
+	// Leave the records to the object that takes the hostname over
+	owner, err := sourceOwner(ctx, r.Client, record.Host, cfg)
+	if err != nil {
+		return err
+	}
+	if owner != nil && (sourceKind(owner) != "Ingress" || client.ObjectKeyFromObject(owner) != client.ObjectKeyFromObject(ingress)) {
+		logger.Info("Host is taken over by another object", "domain", record.Host, "kind", sourceKind(owner), "owner", client.ObjectKeyFromObject(owner).String())
+		return nil
 	}
 
-	// Update the annotation with current domains
-	ingress.Annotations[previousDomainsKey] = strings.Join(currentDomains, ",")
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		if err := r.Get(ctx, client.ObjectKeyFromObject(&ingress), &ingress); err != nil {
-			return err
-		}
-		DomainList := difference(currentDomains, excludeDomains)
-		// ingress.Annotations[previousDomainsKey] = strings.Join(currentDomains, ",")
-		ingress.Annotations[previousDomainsKey] = strings.Join(DomainList, ",")
-		return r.Update(ctx, &ingress)
-	})
+	return w.cleanupRecord(ctx, ingress, record, policy)
+}
+
+// managedRecords returns the records published for an Ingress. Ingresses reconciled before
+// DNSRecordSets existed only have their hostnames, which are assumed to be A records written
+// with the provider from the current annotations.
+func (r *IngressReconciler) managedRecords(ingress *networkingv1.Ingress, recordSet *dnsv1.DNSRecordSet) []dnsv1.ManagedRecord {
+
+	if recordSet != nil {
+		return recordSet.Status.Records
+	}
+
+	ptype, found := ingress.Annotations[typeAnnotationKey]
+	if !found {
+		return nil
+	}
+	source, found := ingress.Annotations[sourceAnnotationKey]
+	if !found {
+		return nil
+	}
+
+	hosts := ingressHosts(ingress, false)
+	if val, found := ingress.Annotations[previousDomainsKey]; found {
+		hosts = normalizeHosts(strings.Split(val, ","))
+	}
 
-	if retryErr != nil {
-		logger.Error(retryErr, "Failed to update ingress annotations")
-		return ctrl.Result{}, retryErr
+	var records []dnsv1.ManagedRecord
+	for _, host := range hosts {
+		records = append(records, dnsv1.ManagedRecord{Host: host, Type: "A", Provider: ptype, Source: source})
 	}
 
-	return ctrl.Result{}, nil
+	return records
 }
 
-func difference(slice1, slice2 []string) []string {
-	// slice1: domainliste
-	// slice2: ExcludeDomains
-	// filteredDomains := difference(domainliste, ExcludeDomains)
+// annotationProviderRef returns the provider the DNS annotations of an Ingress or another
+// source select, and false if they select none.
+func annotationProviderRef(annotations map[string]string) (dnsv1.ProviderReference, bool) {
 
-	m := make(map[string]bool)
-	for _, v := range slice2 {
-		m[v] = true
+	if name, found := annotations[providerAnnotationKey]; found {
+		return dnsv1.ProviderReference{Kind: dnsv1.KindDNSProvider, Name: name}, true
+	}
+	if name, found := annotations[clusterProviderAnnotationKey]; found {
+		return dnsv1.ProviderReference{Kind: dnsv1.KindClusterDNSProvider, Name: name}, true
 	}
 
-	var diff []string
-	for _, v := range slice1 {
-		if !m[v] {
-			diff = append(diff, v)
+	ptype, found := annotations[typeAnnotationKey]
+	if !found {
+		return dnsv1.ProviderReference{}, false
+	}
+	source, found := annotations[sourceAnnotationKey]
+	if !found {
+		return dnsv1.ProviderReference{}, false
+	}
+
+	return dnsv1.ProviderReference{Type: ptype, Source: source}, true
+}
+
+// providerFor returns the DNS provider selected by the annotations of an Ingress.
+// It returns nil without an error if the Ingress does not ask for a known provider.
+func (r *IngressReconciler) providerFor(ctx context.Context, ingress *networkingv1.Ingress, ref dnsv1.ProviderReference, cfg operatorConfig) (*resolvedProvider, error) {
+
+	if ref.Kind == "" {
+		switch ref.Type {
+		case dnsapi.ProviderCloudflare, dnsapi.ProviderBind:
+		default:
+			log.FromContext(ctx).Info(fmt.Sprintf("Unknown DNS configuration type: %s. Skipping...", ref.Type))
+			r.writer().recordEvent(ingress, corev1.EventTypeWarning, reasonUnknownProvider, "Unknown DNS configuration type %s, no DNS records are published", ref.Type)
+			return nil, nil
 		}
 	}
 
-	return diff
+	return r.writer().withConfig(cfg).provider(ctx, ingress.Namespace, ref, nil)
+}
+
+func hasConflict(conflicts []dnsv1.HostConflict, host string) bool {
+
+	for _, conflict := range conflicts {
+		if conflict.Host == host {
+			return true
+		}
+	}
 
+	return false
 }
 
 func containsString(slice []string, str string) bool {
@@ -316,79 +451,56 @@ func containsString(slice []string, str string) bool {
 
 }
 
-// Load DNS configuration from ConfigMap or Secret
-func (r *IngressReconciler) loadDNSConfiguration(ctx context.Context, sourceName string) (map[string]string, error) {
-	config := make(map[string]string)
-
-	namespace := r.ConfigMapNamespace
-
-	// Try to load as ConfigMap
-	var configMap corev1.ConfigMap
-	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: sourceName}, &configMap); err == nil {
-		for key, value := range configMap.Data {
-			config[key] = value
-		}
-		return config, nil
-	}
+// ingressTargets returns the record type and the addresses the records of Ingresses point
+// to: the addresses of the target nodes if configured, else the address of the first target
+// service.
+func ingressTargets(ctx context.Context, c client.Reader, cfg operatorConfig) (string, []string, error) {
 
-	// Try to load as Secret
-	var secret corev1.Secret
-	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: sourceName}, &secret); err == nil {
-		for key, value := range secret.Data {
-			config[key] = string(value)
-		}
-		return config, nil
+	if cfg.TargetNodes != nil {
+		return nodeTargets(ctx, c, cfg)
 	}
 
-	return nil, fmt.Errorf("configuration source %s not found as ConfigMap or Secret in namespace %s", sourceName, namespace)
+	return serviceTargets(ctx, c, cfg.TargetServices)
 }
 
-// Konfiguration aus der ConfigMap laden
-func (r *IngressReconciler) loadTraefikConfig(ctx context.Context) (string, string, []string, error) {
-
-	var configMap corev1.ConfigMap
-
-	err := r.Get(ctx, client.ObjectKey{
-		Namespace: r.ConfigMapNamespace,
-		Name:      r.ConfigMapName,
-	}, &configMap)
+// serviceTargets returns the record type and the address of the first of services that has
+// one.
+func serviceTargets(ctx context.Context, c client.Reader, services []dnsv1.ServiceReference) (string, []string, error) {
 
+	address, err := targetAddress(ctx, c, services)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			// Standardwerte, wenn die ConfigMap nicht gefunden wird
-			return "traefik", "kube-system", nil, nil
-		}
-		return "", "", nil, fmt.Errorf("failed to load ConfigMap: %w", err)
+		return "", nil, err
 	}
-
-	// Standardwerte für Traefik
-	traefikServiceName := configMap.Data["traefikServiceName"]
-	if traefikServiceName == "" {
-		traefikServiceName = "traefik"
+	recordType, err := recordTypeFor(address)
+	if err != nil {
+		return "", nil, err
 	}
 
-	traefikNamespace := configMap.Data["traefikNamespace"]
-	if traefikNamespace == "" {
-		traefikNamespace = "kube-system"
-	}
+	return recordType, []string{address}, nil
+}
 
-	// ExcludeDomains aus YAML laden
-	var excludeDomains []string
-	if excludeDomainsRaw, found := configMap.Data["excludedomains"]; found {
-		if err := yaml.Unmarshal([]byte(excludeDomainsRaw), &excludeDomains); err != nil {
-			return "", "", nil, fmt.Errorf("failed to parse excludedomains: %w", err)
+// targetAddress returns the address of the first target service that has one.
+func targetAddress(ctx context.Context, c client.Reader, services []dnsv1.ServiceReference) (string, error) {
+
+	var errs []error
+	for _, service := range services {
+		address, err := getLoadBalancerIP(ctx, c, service.Namespace, service.Name)
+		if err == nil {
+			log.FromContext(ctx).Info(fmt.Sprintf("LoadBalancer IP for %s/%s: %s", service.Namespace, service.Name, address))
+			return address, nil
 		}
+		errs = append(errs, err)
 	}
 
-	return traefikServiceName, traefikNamespace, excludeDomains, nil
+	return "", kerrors.NewAggregate(errs)
 }
 
 // LoadBalancer-IP des Traefik-Service abrufen
-func (r *IngressReconciler) getLoadBalancerIP(ctx context.Context, namespace string, serviceName string) (string, error) {
+func getLoadBalancerIP(ctx context.Context, c client.Reader, namespace string, serviceName string) (string, error) {
 
 	var service corev1.Service
 
-	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: serviceName}, &service); err != nil {
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: serviceName}, &service); err != nil {
 		return "", fmt.Errorf("failed to get service %s/%s: %w", namespace, serviceName, err)
 	}
 
@@ -406,26 +518,47 @@ func (r *IngressReconciler) getLoadBalancerIP(ctx context.Context, namespace str
 	return "", fmt.Errorf("no LoadBalancer IP or hostname found for service %s/%s", namespace, serviceName)
 }
 
-// Domains aus dem Ingress-Spec extrahieren
-func (r *IngressReconciler) extractDomains(ingress *networkingv1.Ingress) []string {
-
-	var domains []string
+// Domains aus dem Ingress-Spec extrahieren, mit includeTLSHosts auch aus spec.tls. Ohne
+// Hostnamen werden sie aus den hostnameTemplates erzeugt.
+func (r *IngressReconciler) extractDomains(ingress *networkingv1.Ingress, cfg operatorConfig) ([]string, error) {
 
-	for _, rule := range ingress.Spec.Rules {
-		domains = append(domains, rule.Host)
+	if hosts := ingressHosts(ingress, cfg.IncludeTLSHosts); len(hosts) > 0 {
+		return hosts, nil
 	}
 
-	return domains
+	return cfg.generatedHosts(ingress, "Ingress")
 }
 
 func (r *IngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{}, hostIndexKey, indexIngressHosts); err != nil {
+		return err
+	}
+
+	if err := metrics.Registry.Register(&recordSetCollector{client: mgr.GetClient()}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&networkingv1.Ingress{}).
+		For(&networkingv1.Ingress{}, builder.WithPredicates(r.Scope.predicate())).
+		Owns(&dnsv1.DNSRecordSet{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&networkingv1.Ingress{}, handler.EnqueueRequestsFromMapFunc(r.ingressesSharingHosts), builder.WithPredicates(r.Scope.predicate())).
+		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForNode), builder.WithPredicates(nodeTargetChanged)).
 		Named("ingress").
 		Complete(r)
 }
 
+// ingressesForNode maps a node to the Ingresses with records if they point to the nodes.
+func (r *IngressReconciler) ingressesForNode(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	cfg, err := r.writer().loadOperatorConfig(ctx)
+	if err != nil || cfg.TargetNodes == nil {
+		return nil
+	}
+
+	return publishedObjects(ctx, r.Client, &networkingv1.IngressList{})
+}
+
 func removeString(slice []string, str string) []string {
 
 	var result []string
@@ -439,6 +572,25 @@ func removeString(slice []string, str string) []string {
 	return result
 }
 
+// releaseIngress removes the finalizer from an Ingress the operator does not manage, unless
+// records published while it was managed are left; those are cleaned up on deletion.
+func (r *IngressReconciler) releaseIngress(ctx context.Context, ingress *networkingv1.Ingress) error {
+
+	if !containsString(ingress.Finalizers, cleanupFinalizer) {
+		return nil
+	}
+
+	recordSet, err := getRecordSet(ctx, r.Client, r.Scheme, ingress)
+	if err != nil {
+		return err
+	}
+	if len(r.managedRecords(ingress, recordSet)) > 0 {
+		return nil
+	}
+
+	return r.removeFinalizer(ctx, ingress)
+}
+
 // AddFinalizer ensures that the finalizer is added safely
 func (r *IngressReconciler) addFinalizer(ctx context.Context, ingress *networkingv1.Ingress) error {
 
@@ -450,8 +602,8 @@ func (r *IngressReconciler) addFinalizer(ctx context.Context, ingress *networkin
 		}
 
 		// Finalizer hinzufügen, falls noch nicht vorhanden
-		if !containsString(ingress.Finalizers, ingressFinalizer) {
-			ingress.Finalizers = append(ingress.Finalizers, ingressFinalizer)
+		if !containsString(ingress.Finalizers, cleanupFinalizer) {
+			ingress.Finalizers = append(ingress.Finalizers, cleanupFinalizer)
 			if err := r.Update(ctx, ingress); err != nil {
 				return err
 			}
@@ -474,8 +626,8 @@ func (r *IngressReconciler) removeFinalizer(ctx context.Context, ingress *networ
 		}
 
 		// Finalizer entfernen, falls vorhanden
-		if containsString(ingress.Finalizers, ingressFinalizer) {
-			ingress.Finalizers = removeString(ingress.Finalizers, ingressFinalizer)
+		if containsString(ingress.Finalizers, cleanupFinalizer) {
+			ingress.Finalizers = removeString(ingress.Finalizers, cleanupFinalizer)
 			if err := r.Update(ctx, ingress); err != nil {
 				return err
 			}
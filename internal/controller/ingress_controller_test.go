@@ -18,18 +18,177 @@ package controller
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
 )
 
+// newFakeClient returns a fake client with the indexes and status subresources the reconcilers use.
+func newFakeClient(objects ...client.Object) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(objects...).
+		WithIndex(&k8snetworkingv1.Ingress{}, hostIndexKey, indexIngressHosts).
+		WithIndex(&networkingv1.DNSEndpoint{}, endpointHostnameIndexKey, indexEndpointHostname).
+		WithIndex(httpRouteSource.newObject(), sourceHostIndexKey, indexSourceHosts(httpRouteSource)).
+		WithIndex(grpcRouteSource.newObject(), sourceHostIndexKey, indexSourceHosts(grpcRouteSource)).
+		WithIndex(tlsRouteSource.newObject(), sourceHostIndexKey, indexSourceHosts(tlsRouteSource)).
+		WithIndex(ingressRouteSource.newObject(), sourceHostIndexKey, indexSourceHosts(ingressRouteSource)).
+		WithIndex(serviceHostSource.newObject(), sourceHostIndexKey, indexSourceHosts(serviceHostSource)).
+		WithStatusSubresource(&networkingv1.DNSRecordSet{}, &networkingv1.DNSEndpoint{}, &networkingv1.DNSProvider{}, &networkingv1.ClusterDNSProvider{}, &networkingv1.DNSManagerConfig{}).
+		Build()
+}
+
+// newTestReconciler returns an IngressReconciler on a fake client with objects. It reads the
+// operator configuration dns-operator-config from namespace and publishes with provider.
+func newTestReconciler(namespace string, provider *fakeProvider, objects ...client.Object) *IngressReconciler {
+	return &IngressReconciler{
+		Client:             newFakeClient(objects...),
+		Scheme:             scheme.Scheme,
+		ConfigMapName:      "dns-operator-config",
+		ConfigMapNamespace: namespace,
+		NewProvider:        provider.factory,
+	}
+}
+
+// newTestSourceReconciler returns a sourceReconciler for source like newTestReconciler.
+func newTestSourceReconciler(source hostSource, namespace string, provider *fakeProvider, objects ...client.Object) *sourceReconciler {
+	return &sourceReconciler{
+		Client:             newFakeClient(objects...),
+		Scheme:             scheme.Scheme,
+		ConfigMapName:      "dns-operator-config",
+		ConfigMapNamespace: namespace,
+		NewProvider:        provider.factory,
+		source:             source,
+	}
+}
+
+// loadBalancer returns a Service in kube-system whose load balancer has the address ip.
+func loadBalancer(name string, ip string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: ip}}},
+		},
+	}
+}
+
+// cloudflareSource returns a ConfigMap with Cloudflare credentials.
+func cloudflareSource(name string, namespace string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       map[string]string{"zoneid": "zone", "token": "token"},
+	}
+}
+
+// fakeProvider keeps DNS records in memory. Requests for a name in failing return its error.
+// factory records the type and configuration it was created with.
+type fakeProvider struct {
+	ptype       string
+	config      map[string]string
+	records     []dnsapi.Record
+	failing     map[string]error
+	noWildcards bool
+	zone        string
+}
+
+// factory returns the provider for every type and remembers the type, see ProviderFactory.
+func (p *fakeProvider) factory(ptype string, config map[string]string) (dnsapi.Provider, error) {
+	p.ptype = ptype
+	p.config = config
+	return p, nil
+}
+
+func (p *fakeProvider) GetRecords(name string, rtype string) ([]dnsapi.Record, error) {
+	if err := p.failing[name]; err != nil {
+		return nil, err
+	}
+	var records []dnsapi.Record
+	for _, record := range p.records {
+		if strings.EqualFold(record.Name, name) && record.Type == rtype {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (p *fakeProvider) AddRecord(name string, rtype string, content string) (dnsapi.Record, error) {
+	record := dnsapi.Record{ID: name + "/" + rtype + "/" + content, Name: name, Type: rtype, Content: content}
+	p.records = append(p.records, record)
+	return record, nil
+}
+
+func (p *fakeProvider) UpdateRecord(record dnsapi.Record, content string) error {
+	for i := range p.records {
+		if p.records[i].ID == record.ID {
+			p.records[i].Content = content
+		}
+	}
+	return nil
+}
+
+func (p *fakeProvider) DeleteRecord(record dnsapi.Record) error {
+	if err := p.failing[record.Name]; err != nil {
+		return err
+	}
+	var records []dnsapi.Record
+	for _, r := range p.records {
+		if r.ID != record.ID {
+			records = append(records, r)
+		}
+	}
+	p.records = records
+	return nil
+}
+
+// seed adds an existing record.
+func (p *fakeProvider) seed(name string, rtype string, content string) {
+	p.records = append(p.records, dnsapi.Record{ID: name + "/" + rtype + "/" + content, Name: name, Type: rtype, Content: content})
+}
+
+func (p *fakeProvider) Zone() string {
+	if p.zone != "" {
+		return p.zone
+	}
+	return "example.com"
+}
+
+// Verify fails with the error in failing for the zone.
+func (p *fakeProvider) Verify() error {
+	return p.failing[p.Zone()]
+}
+
+func (p *fakeProvider) SupportsWildcards() bool {
+	return !p.noWildcards
+}
+
+func (p *fakeProvider) content(name string, rtype string) []string {
+	var content []string
+	for _, record := range p.records {
+		if strings.EqualFold(record.Name, name) && record.Type == rtype {
+			content = append(content, record.Content)
+		}
+	}
+	return content
+}
+
 var _ = Describe("Ingress Controller", func() {
 	Context("When reconciling a resource", func() {
 		const resourceName = "test-resource"
@@ -40,26 +199,32 @@ var _ = Describe("Ingress Controller", func() {
 			Name:      resourceName,
 			Namespace: "default", // TODO(user):Modify as needed
 		}
-		ingress := &networkingv1.Ingress{}
+		ingress := &k8snetworkingv1.Ingress{}
 
 		BeforeEach(func() {
-			By("creating the custom resource for the Kind Ingress")
+			requireEnvtest()
+			By("creating the Ingress")
 			err := k8sClient.Get(ctx, typeNamespacedName, ingress)
 			if err != nil && errors.IsNotFound(err) {
-				resource := &networkingv1.Ingress{
+				resource := &k8snetworkingv1.Ingress{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
 					},
-					// TODO(user): Specify other spec details if needed.
+					Spec: k8snetworkingv1.IngressSpec{
+						Rules: []k8snetworkingv1.IngressRule{{Host: "test.example.com"}},
+					},
 				}
 				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 			}
 		})
 
 		AfterEach(func() {
+			if k8sClient == nil {
+				return
+			}
 			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &networkingv1.Ingress{}
+			resource := &k8snetworkingv1.Ingress{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -69,8 +234,10 @@ var _ = Describe("Ingress Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &IngressReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				ConfigMapName:      "dns-operator-config",
+				ConfigMapNamespace: "default",
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -81,4 +248,940 @@ var _ = Describe("Ingress Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When cleaning up a deleted Ingress", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider       *fakeProvider
+			reconciler     *IngressReconciler
+			ingress        *k8snetworkingv1.Ingress
+			operatorConfig *corev1.ConfigMap
+		)
+
+		newReconciler := func(objects ...client.Object) *IngressReconciler {
+			return newTestReconciler(namespace, provider, objects...)
+		}
+
+		reconcileIngress := func() {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			now := metav1.Now()
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "cleanup",
+					Namespace:         namespace,
+					DeletionTimestamp: &now,
+					Finalizers:        []string{cleanupFinalizer},
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{
+						{Host: "app.example.com"},
+						{Host: "excluded.example.com"},
+					},
+				},
+			}
+			operatorConfig = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: namespace},
+				Data: map[string]string{
+					"excludedomains": "- excluded.example.com\n",
+				},
+			}
+			for _, host := range []string{"app.example.com", "excluded.example.com"} {
+				provider.seed(host, "A", "192.0.2.1")
+				provider.seed(host, "TXT", ownerTXTValue)
+			}
+		})
+
+		dnsConfig := func() *corev1.ConfigMap {
+			return cloudflareSource("dns-config", namespace)
+		}
+
+		It("should delete owned records and keep excluded domains", func() {
+			reconciler = newReconciler(ingress, operatorConfig, dnsConfig())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("app.example.com", "TXT")).To(BeEmpty())
+			Expect(provider.content("excluded.example.com", "A")).To(ConsistOf("192.0.2.1"))
+			Expect(provider.content("excluded.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+
+			err := reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), &k8snetworkingv1.Ingress{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should not delete records that are not owned by kube-dns-manager", func() {
+			provider.records = nil
+			provider.seed("app.example.com", "A", "192.0.2.1")
+			provider.seed("app.example.com", "TXT", "v=spf1 -all")
+
+			reconciler = newReconciler(ingress, operatorConfig, dnsConfig())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.1"))
+			Expect(provider.content("app.example.com", "TXT")).To(ConsistOf("v=spf1 -all"))
+		})
+
+		It("should use the provider from the type annotation", func() {
+			ingress.Annotations[typeAnnotationKey] = dnsapi.ProviderBind
+
+			reconciler = newReconciler(ingress, operatorConfig, dnsConfig())
+			reconcileIngress()
+
+			Expect(provider.ptype).To(Equal(dnsapi.ProviderBind))
+			Expect(provider.content("app.example.com", "A")).To(BeEmpty())
+		})
+
+		It("should mark records as orphaned with the retain deletion policy", func() {
+			ingress.Annotations[deletionPolicyAnnotation] = DeletionPolicyRetain
+
+			reconciler = newReconciler(ingress, operatorConfig, dnsConfig())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.1"))
+			Expect(provider.content("app.example.com", "TXT")).To(ConsistOf(orphanedTXTValue))
+			Expect(provider.content("excluded.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+		})
+
+		It("should retain records with the deletion policy of the operator configuration", func() {
+			operatorConfig.Data["deletionPolicy"] = DeletionPolicyRetain
+
+			reconciler = newReconciler(ingress, operatorConfig, dnsConfig())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.1"))
+			Expect(provider.content("app.example.com", "TXT")).To(ConsistOf(orphanedTXTValue))
+		})
+
+		It("should prefer the annotation over the deletion policy of the operator configuration", func() {
+			operatorConfig.Data["deletionPolicy"] = DeletionPolicyRetain
+			ingress.Annotations[deletionPolicyAnnotation] = DeletionPolicyDelete
+
+			reconciler = newReconciler(ingress, operatorConfig, dnsConfig())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("app.example.com", "TXT")).To(BeEmpty())
+		})
+
+		It("should retain records with an unknown deletion policy", func() {
+			ingress.Annotations[deletionPolicyAnnotation] = "keep"
+
+			reconciler = newReconciler(ingress, operatorConfig, dnsConfig())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.1"))
+			Expect(provider.content("app.example.com", "TXT")).To(ConsistOf(orphanedTXTValue))
+
+			err := reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), &k8snetworkingv1.Ingress{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+	Context("When publishing an Ingress", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider   *fakeProvider
+			recorder   *events.FakeRecorder
+			reconciler *IngressReconciler
+			ingress    *k8snetworkingv1.Ingress
+		)
+
+		reconcileIngress := func() {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		recordSet := func() *networkingv1.DNSRecordSet {
+			var recordSet networkingv1.DNSRecordSet
+			key := types.NamespacedName{Name: "ingress-" + ingress.Name, Namespace: namespace}
+			Expect(reconciler.Get(ctx, key, &recordSet)).To(Succeed())
+			return &recordSet
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			recorder = events.NewFakeRecorder(20)
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "publish",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{
+						{Host: "app.example.com"},
+						{Host: "api.example.com"},
+					},
+				},
+			}
+			reconciler = newTestReconciler(namespace, provider, ingress, loadBalancer("traefik", "192.0.2.10"), cloudflareSource("dns-config", namespace))
+			reconciler.Recorder = recorder
+		})
+
+		It("should record the published records in a DNSRecordSet", func() {
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("app.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+
+			records := recordSet().Status.Records
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Host).To(Equal("app.example.com"))
+			Expect(records[0].Type).To(Equal("A"))
+			Expect(records[0].Target).To(Equal("192.0.2.10"))
+			Expect(records[0].Provider).To(Equal(dnsapi.ProviderCloudflare))
+			Expect(records[0].Source).To(Equal(namespace + "/dns-config"))
+			Expect(records[0].Zone).To(Equal("example.com"))
+			Expect(records[0].RecordIDs).To(ConsistOf("app.example.com/A/192.0.2.10", "app.example.com/TXT/"+ownerTXTValue))
+		})
+
+		It("should remove records of hosts that were removed from the Ingress", func() {
+			reconcileIngress()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Spec.Rules = ingress.Spec.Rules[:1]
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("api.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("api.example.com", "TXT")).To(BeEmpty())
+			Expect(recordSet().Status.Records).To(HaveLen(1))
+		})
+
+		It("should report the state of every host", func() {
+			Expect(reconciler.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: namespace},
+				Data:       map[string]string{"excludedomains": "- api.example.com\n"},
+			})).To(Succeed())
+			reconcileIngress()
+
+			status := recordSet().Status
+			Expect(status.ObservedGeneration).To(Equal(ingress.Generation))
+			Expect(status.Hosts).To(Equal([]networkingv1.HostStatus{
+				{Host: "api.example.com", State: networkingv1.HostStateExcluded},
+				{Host: "app.example.com", State: networkingv1.HostStatePublished, Target: "192.0.2.10", Provider: dnsapi.ProviderCloudflare},
+			}))
+			Expect(status.Conditions).To(HaveLen(1))
+			Expect(status.Conditions[0].Type).To(Equal(networkingv1.ConditionReady))
+			Expect(status.Conditions[0].Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should export metrics for provider requests and managed records", func() {
+			creates := providerRequests.WithLabelValues(dnsapi.ProviderCloudflare, "create", "success")
+			before := testutil.ToFloat64(creates)
+			reconcileIngress()
+
+			Expect(testutil.ToFloat64(creates) - before).To(BeEquivalentTo(4))
+			Expect(testutil.ToFloat64(lastSuccessfulSync.WithLabelValues("example.com"))).To(BeNumerically(">", 0))
+
+			collector := &recordSetCollector{client: reconciler.Client}
+			Expect(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP kube_dns_manager_managed_records Number of DNS records managed by kube-dns-manager by zone and type.
+# TYPE kube_dns_manager_managed_records gauge
+kube_dns_manager_managed_records{type="A",zone="example.com"} 2
+`), "kube_dns_manager_managed_records")).To(Succeed())
+		})
+
+		It("should keep tracking a published record whose owner record was replaced", func() {
+			reconcileIngress()
+
+			Expect(provider.DeleteRecord(dnsapi.Record{ID: "app.example.com/TXT/" + ownerTXTValue})).To(Succeed())
+			provider.seed("app.example.com", "TXT", "v=spf1 -all")
+			reconcileIngress()
+
+			status := recordSet().Status
+			Expect(status.Records).To(HaveLen(2))
+			Expect(status.Failures).To(HaveLen(1))
+			Expect(status.Failures[0].Host).To(Equal("app.example.com"))
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		})
+
+		It("should count records that were changed outside kube-dns-manager", func() {
+			repairs := driftRepairs.WithLabelValues(dnsapi.ProviderCloudflare, "example.com")
+			before := testutil.ToFloat64(repairs)
+			reconcileIngress()
+
+			Expect(provider.DeleteRecord(dnsapi.Record{ID: "app.example.com/A/192.0.2.10"})).To(Succeed())
+			reconcileIngress()
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(testutil.ToFloat64(repairs) - before).To(BeEquivalentTo(1))
+		})
+
+		It("should emit Events for every DNS change", func() {
+			provider.seed("api.example.com", "A", "192.0.2.1")
+			provider.seed("api.example.com", "TXT", ownerTXTValue)
+			reconcileIngress()
+
+			Expect(recorder.Events).To(Receive(Equal("Normal RecordCreated Created A record app.example.com pointing to 192.0.2.10")))
+			Expect(recorder.Events).To(Receive(Equal("Normal RecordUpdated Updated A record api.example.com from 192.0.2.1 to 192.0.2.10")))
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Spec.Rules = ingress.Spec.Rules[:1]
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+			reconcileIngress()
+
+			Expect(recorder.Events).To(Receive(Equal("Normal RecordDeleted Deleted A record api.example.com")))
+		})
+
+		It("should emit a Warning Event for an unknown provider type", func() {
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Annotations[typeAnnotationKey] = "route53"
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+			reconcileIngress()
+
+			Expect(recorder.Events).To(Receive(ContainSubstring("Warning UnknownProvider")))
+			Expect(provider.records).To(BeEmpty())
+		})
+
+		It("should keep the records of hostnames older versions stored in mixed case", func() {
+			reconcileIngress()
+
+			// Older versions stored the hostnames as declared in the Ingress
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Spec.Rules[0].Host = "App.Example.com"
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+			stored := recordSet()
+			stored.Status.Records[0].Host = "App.Example.com."
+			Expect(reconciler.Status().Update(ctx, stored)).To(Succeed())
+			published := append([]dnsapi.Record(nil), provider.records...)
+			for len(recorder.Events) > 0 {
+				<-recorder.Events
+			}
+
+			reconcileIngress()
+
+			Expect(provider.records).To(Equal(published))
+			Expect(recorder.Events).To(BeEmpty())
+			Expect(recordSet().Status.Records[0].Host).To(Equal("app.example.com"))
+		})
+
+		It("should migrate the previous-domains annotation", func() {
+			provider.seed("old.example.com", "A", "192.0.2.10")
+			provider.seed("old.example.com", "TXT", ownerTXTValue)
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Annotations[previousDomainsKey] = "app.example.com,old.example.com"
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+
+			reconcileIngress()
+
+			Expect(provider.content("old.example.com", "A")).To(BeEmpty())
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			Expect(ingress.Annotations).NotTo(HaveKey(previousDomainsKey))
+		})
+	})
+	Context("When several Ingresses declare the same host", func() {
+		ctx := context.Background()
+
+		var (
+			provider   *fakeProvider
+			recorder   *events.FakeRecorder
+			reconciler *IngressReconciler
+			older      *k8snetworkingv1.Ingress
+			newer      *k8snetworkingv1.Ingress
+		)
+
+		newIngress := func(namespace string, created time.Time) *k8snetworkingv1.Ingress {
+			return &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "app",
+					Namespace:         namespace,
+					CreationTimestamp: metav1.NewTime(created),
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{{Host: "app.example.com"}},
+				},
+			}
+		}
+
+		setup := func() {
+			reconciler = newTestReconciler("default", provider, older, newer, loadBalancer("traefik", "192.0.2.10"), cloudflareSource("dns-config", "default"))
+			reconciler.Recorder = recorder
+		}
+
+		reconcileIngress := func(ingress *k8snetworkingv1.Ingress) {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		recordSet := func(ingress *k8snetworkingv1.Ingress) *networkingv1.DNSRecordSet {
+			var recordSet networkingv1.DNSRecordSet
+			key := types.NamespacedName{Name: "ingress-" + ingress.Name, Namespace: ingress.Namespace}
+			Expect(reconciler.Get(ctx, key, &recordSet)).To(Succeed())
+			return &recordSet
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			recorder = events.NewFakeRecorder(10)
+			now := time.Now()
+			older = newIngress("team-a", now.Add(-time.Hour))
+			newer = newIngress("team-b", now)
+		})
+
+		It("should publish the host only for the oldest Ingress", func() {
+			setup()
+			reconcileIngress(newer)
+			reconcileIngress(older)
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(recordSet(older).Status.Records).To(HaveLen(1))
+			Expect(recordSet(newer).Status.Records).To(BeEmpty())
+			Expect(recordSet(newer).Status.Conflicts).To(ConsistOf(networkingv1.HostConflict{
+				Host:  "app.example.com",
+				Owner: "team-a/app",
+			}))
+			Expect(recorder.Events).To(Receive(ContainSubstring("HostConflict")))
+		})
+
+		It("should prefer the Ingress with the higher priority", func() {
+			newer.Annotations[priorityAnnotation] = "10"
+			setup()
+			reconcileIngress(older)
+			reconcileIngress(newer)
+
+			Expect(recordSet(newer).Status.Records).To(HaveLen(1))
+			Expect(recordSet(older).Status.Conflicts).To(HaveLen(1))
+		})
+
+		It("should keep the records when the owner is deleted and another Ingress declares the host", func() {
+			setup()
+			reconcileIngress(older)
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(older), older)).To(Succeed())
+			Expect(reconciler.Delete(ctx, older)).To(Succeed())
+			reconcileIngress(older)
+
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("app.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+
+			reconcileIngress(newer)
+			Expect(recordSet(newer).Status.Records).To(HaveLen(1))
+			Expect(recordSet(newer).Status.Conflicts).To(BeEmpty())
+		})
+	})
+	Context("When a DNS provider fails", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider   *fakeProvider
+			reconciler *IngressReconciler
+			ingress    *k8snetworkingv1.Ingress
+			dnsConfig  *corev1.ConfigMap
+		)
+
+		outage := &dnsapi.APIError{Provider: dnsapi.ProviderCloudflare, Code: 503, Message: "Service Unavailable", Transient: true}
+
+		setup := func(objects ...client.Object) {
+			reconciler = newTestReconciler(namespace, provider, append(objects, ingress, loadBalancer("traefik", "192.0.2.10"))...)
+		}
+
+		reconcileIngress := func() reconcile.Result {
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return result
+		}
+
+		recordSet := func() *networkingv1.DNSRecordSet {
+			var recordSet networkingv1.DNSRecordSet
+			key := types.NamespacedName{Name: "ingress-" + ingress.Name, Namespace: namespace}
+			Expect(reconciler.Get(ctx, key, &recordSet)).To(Succeed())
+			return &recordSet
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{failing: map[string]error{}}
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "failing",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{
+						{Host: "app.example.com"},
+						{Host: "api.example.com"},
+					},
+				},
+			}
+			dnsConfig = cloudflareSource("dns-config", namespace)
+		})
+
+		It("should publish the other hosts and retry the failed one with backoff", func() {
+			provider.failing["api.example.com"] = outage
+			setup(dnsConfig)
+
+			Expect(reconcileIngress().RequeueAfter).To(Equal(minRetryDelay))
+			Expect(provider.content("app.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(recordSet().Status.Failures).To(ConsistOf(networkingv1.HostFailure{
+				Host:     "api.example.com",
+				Message:  outage.Error(),
+				Attempts: 1,
+			}))
+
+			Expect(reconcileIngress().RequeueAfter).To(Equal(2 * minRetryDelay))
+			Expect(recordSet().Status.Failures[0].Attempts).To(BeEquivalentTo(2))
+			Expect(recordSet().Status.Hosts).To(ContainElement(networkingv1.HostStatus{
+				Host:     "api.example.com",
+				State:    networkingv1.HostStateFailed,
+				Provider: dnsapi.ProviderCloudflare,
+				Message:  outage.Error(),
+			}))
+			Expect(recordSet().Status.Conditions[0].Reason).To(Equal("HostsFailed"))
+
+			delete(provider.failing, "api.example.com")
+			Expect(reconcileIngress().RequeueAfter).To(BeZero())
+			Expect(provider.content("api.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(recordSet().Status.Records).To(HaveLen(2))
+			Expect(recordSet().Status.Failures).To(BeEmpty())
+			Expect(recordSet().Status.Conditions[0].Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should not retry permanent failures before the maximum delay", func() {
+			provider.failing["api.example.com"] = &dnsapi.APIError{Provider: dnsapi.ProviderCloudflare, Code: 403, Message: "Forbidden"}
+			setup(dnsConfig)
+
+			Expect(reconcileIngress().RequeueAfter).To(Equal(maxRetryDelay))
+			Expect(recordSet().Status.Failures).To(HaveLen(1))
+			Expect(recordSet().Status.Failures[0].Permanent).To(BeTrue())
+		})
+
+		It("should retry when the configuration source is missing", func() {
+			setup()
+
+			Expect(reconcileIngress().RequeueAfter).To(Equal(minRetryDelay))
+			Expect(recordSet().Status.Failures).To(HaveLen(2))
+			Expect(provider.content("app.example.com", "A")).To(BeEmpty())
+		})
+
+		It("should keep the finalizer until the records are removed", func() {
+			setup(dnsConfig)
+			reconcileIngress()
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			Expect(reconciler.Delete(ctx, ingress)).To(Succeed())
+			provider.failing["api.example.com"] = outage
+
+			Expect(reconcileIngress().RequeueAfter).To(Equal(minRetryDelay))
+			Expect(provider.content("app.example.com", "A")).To(BeEmpty())
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			Expect(ingress.Finalizers).To(ContainElement(cleanupFinalizer))
+			Expect(recordSet().Status.Records).To(HaveLen(1))
+
+			delete(provider.failing, "api.example.com")
+			reconcileIngress()
+			Expect(provider.content("api.example.com", "A")).To(BeEmpty())
+			err := reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+	Context("When an Ingress switches its provider", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			providers  map[string]*fakeProvider
+			reconciler *IngressReconciler
+			ingress    *k8snetworkingv1.Ingress
+		)
+
+		// provider returns the fake provider of a type and the zone ID of its source.
+		provider := func(ptype string, zoneID string) *fakeProvider {
+			return providers[ptype+"/"+zoneID]
+		}
+
+		reconcileIngress := func() *networkingv1.DNSRecordSet {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+
+			var recordSet networkingv1.DNSRecordSet
+			key := types.NamespacedName{Name: "ingress-" + ingress.Name, Namespace: namespace}
+			Expect(reconciler.Get(ctx, key, &recordSet)).To(Succeed())
+			return &recordSet
+		}
+
+		// switchTo points the stored Ingress to another type and source.
+		switchTo := func(ptype string, source string) {
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+			ingress.Annotations[typeAnnotationKey] = ptype
+			ingress.Annotations[sourceAnnotationKey] = source
+			Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			providers = map[string]*fakeProvider{
+				"bind/":                {ptype: dnsapi.ProviderBind},
+				"cloudflare/zone":      {ptype: dnsapi.ProviderCloudflare, failing: map[string]error{}},
+				"cloudflare/zone-copy": {ptype: dnsapi.ProviderCloudflare},
+				"cloudflare/shop":      {ptype: dnsapi.ProviderCloudflare, zone: "shop.example.com"},
+			}
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "web",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderBind,
+						sourceAnnotationKey: "bind-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}}},
+			}
+			source := func(name string, data map[string]string) *corev1.ConfigMap {
+				return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Data: data}
+			}
+			reconciler = newTestReconciler(namespace, nil, ingress,
+				loadBalancer("traefik", "192.0.2.10"),
+				source("bind-config", map[string]string{"server": "10.0.0.53"}),
+				cloudflareSource("cloudflare-config", namespace),
+				source("cloudflare-copy", map[string]string{"zoneid": "zone-copy", "token": "other-token"}),
+				source("cloudflare-shop", map[string]string{"zoneid": "shop", "token": "token"}),
+			)
+			reconciler.NewProvider = func(ptype string, config map[string]string) (dnsapi.Provider, error) {
+				return provider(ptype, config["zoneid"]), nil
+			}
+			reconcileIngress()
+		})
+
+		It("should move the records to the new provider type", func() {
+			Expect(provider(dnsapi.ProviderBind, "").content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+
+			switchTo(dnsapi.ProviderCloudflare, "cloudflare-config")
+			recordSet := reconcileIngress()
+
+			Expect(provider(dnsapi.ProviderCloudflare, "zone").content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider(dnsapi.ProviderBind, "").records).To(BeEmpty())
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Records[0].Provider).To(Equal(dnsapi.ProviderCloudflare))
+			Expect(recordSet.Status.Records[0].Source).To(Equal(namespace + "/cloudflare-config"))
+		})
+
+		It("should move the records to the zone of the new source", func() {
+			switchTo(dnsapi.ProviderCloudflare, "cloudflare-config")
+			reconcileIngress()
+
+			switchTo(dnsapi.ProviderCloudflare, "cloudflare-shop")
+			recordSet := reconcileIngress()
+
+			Expect(provider(dnsapi.ProviderCloudflare, "shop").content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider(dnsapi.ProviderCloudflare, "zone").records).To(BeEmpty())
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Records[0].Zone).To(Equal("shop.example.com"))
+		})
+
+		It("should keep the records when the new source writes the same zone", func() {
+			switchTo(dnsapi.ProviderCloudflare, "cloudflare-config")
+			reconcileIngress()
+			// Both sources are credentials for the same zone
+			providers["cloudflare/zone-copy"] = provider(dnsapi.ProviderCloudflare, "zone")
+
+			switchTo(dnsapi.ProviderCloudflare, "cloudflare-copy")
+			recordSet := reconcileIngress()
+
+			Expect(provider(dnsapi.ProviderCloudflare, "zone").content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Records[0].Source).To(Equal(namespace + "/cloudflare-copy"))
+		})
+
+		It("should keep the previous records until the new provider has published the host", func() {
+			provider(dnsapi.ProviderCloudflare, "zone").failing["shop.example.com"] = errors.NewServiceUnavailable("outage")
+
+			switchTo(dnsapi.ProviderCloudflare, "cloudflare-config")
+			recordSet := reconcileIngress()
+
+			Expect(provider(dnsapi.ProviderBind, "").content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Records[0].Provider).To(Equal(dnsapi.ProviderBind))
+			Expect(recordSet.Status.Failures).To(HaveLen(2))
+
+			delete(provider(dnsapi.ProviderCloudflare, "zone").failing, "shop.example.com")
+			recordSet = reconcileIngress()
+
+			Expect(provider(dnsapi.ProviderCloudflare, "zone").content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider(dnsapi.ProviderBind, "").records).To(BeEmpty())
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Failures).To(BeEmpty())
+		})
+
+		It("should report a move that waits for the new provider", func() {
+			provider(dnsapi.ProviderCloudflare, "zone").failing["shop.example.com"] = errors.NewServiceUnavailable("outage")
+
+			switchTo(dnsapi.ProviderCloudflare, "cloudflare-config")
+			recordSet := reconcileIngress()
+
+			Expect(recordSet.Status.Failures).To(ContainElement(SatisfyAll(
+				HaveField("Host", "shop.example.com"),
+				HaveField("Provider", "bind/"+namespace+"/bind-config"),
+				HaveField("Message", ContainSubstring("kept at "+namespace+"/bind-config")),
+				HaveField("Permanent", BeFalse()),
+			)))
+			Expect(recordSet.Status.Hosts).To(ConsistOf(SatisfyAll(
+				HaveField("State", networkingv1.HostStateFailed),
+				HaveField("Message", ContainSubstring("until the host is published with the new provider")),
+			)))
+
+			recordSet = reconcileIngress()
+			Expect(recordSet.Status.Failures).To(ContainElement(SatisfyAll(
+				HaveField("Provider", "bind/"+namespace+"/bind-config"),
+				HaveField("Attempts", BeEquivalentTo(2)),
+			)))
+		})
+	})
+
+	Context("When namespaceLocalSources is toggled", func() {
+		const namespace = "shop"
+
+		ctx := context.Background()
+
+		var (
+			shared        *fakeProvider
+			local         *fakeProvider
+			reconciler    *IngressReconciler
+			ingress       *k8snetworkingv1.Ingress
+			managerConfig *networkingv1.DNSManagerConfig
+			objects       []client.Object
+		)
+
+		reconcileIngress := func() *networkingv1.DNSRecordSet {
+			if reconciler == nil {
+				reconciler = newTestReconciler("kube-system", shared, append(objects, ingress, managerConfig)...)
+				reconciler.NewProvider = func(ptype string, config map[string]string) (dnsapi.Provider, error) {
+					if config["zoneid"] == "local" {
+						return local, nil
+					}
+					return shared, nil
+				}
+			}
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+
+			var recordSet networkingv1.DNSRecordSet
+			Expect(reconciler.Get(ctx, client.ObjectKey{Name: "ingress-web", Namespace: namespace}, &recordSet)).To(Succeed())
+			return &recordSet
+		}
+
+		BeforeEach(func() {
+			shared = &fakeProvider{}
+			local = &fakeProvider{zone: "shop.example.com"}
+			reconciler = nil
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "web",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}}},
+			}
+			managerConfig = &networkingv1.DNSManagerConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+				Spec: networkingv1.DNSManagerConfigSpec{
+					TargetServices: []networkingv1.ServiceReference{{Name: "traefik", Namespace: "kube-system"}},
+				},
+			}
+			localSource := cloudflareSource("dns-config", namespace)
+			localSource.Data["zoneid"] = "local"
+			objects = []client.Object{
+				loadBalancer("traefik", "192.0.2.10"),
+				cloudflareSource("dns-config", "kube-system"),
+				localSource,
+			}
+		})
+
+		It("should move the records to the namespace-local source once it is enabled", func() {
+			recordSet := reconcileIngress()
+			Expect(shared.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(recordSet.Status.Records[0].Source).To(Equal("kube-system/dns-config"))
+
+			Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(managerConfig), managerConfig)).To(Succeed())
+			managerConfig.Spec.NamespaceLocalSources = true
+			Expect(reconciler.Update(ctx, managerConfig)).To(Succeed())
+			recordSet = reconcileIngress()
+
+			Expect(local.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(shared.records).To(BeEmpty())
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Records[0].Source).To(Equal(namespace + "/dns-config"))
+		})
+
+		It("should read bare source names of earlier records from the operator namespace", func() {
+			managerConfig.Spec.NamespaceLocalSources = true
+			shared.seed("shop.example.com", "A", "192.0.2.1")
+			shared.seed("shop.example.com", "TXT", ownerTXTValue)
+			objects = append(objects, &networkingv1.DNSRecordSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "ingress-web", Namespace: namespace},
+				Status: networkingv1.DNSRecordSetStatus{Records: []networkingv1.ManagedRecord{{
+					Host:     "shop.example.com",
+					Type:     "A",
+					Target:   "192.0.2.1",
+					Provider: dnsapi.ProviderCloudflare,
+					Source:   "dns-config",
+					Zone:     "example.com",
+				}}},
+			})
+			recordSet := reconcileIngress()
+
+			Expect(local.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(shared.records).To(BeEmpty())
+			Expect(recordSet.Status.Records).To(HaveLen(1))
+			Expect(recordSet.Status.Records[0].Source).To(Equal(namespace + "/dns-config"))
+		})
+	})
+
+	Context("When reading the hostnames of an Ingress", func() {
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		var (
+			provider      *fakeProvider
+			reconciler    *IngressReconciler
+			ingress       *k8snetworkingv1.Ingress
+			managerConfig *networkingv1.DNSManagerConfig
+			objects       []client.Object
+		)
+
+		reconcileIngress := func(ingress *k8snetworkingv1.Ingress) *networkingv1.DNSRecordSet {
+			if reconciler == nil {
+				reconciler = newTestReconciler(namespace, provider, append(objects, ingress, managerConfig)...)
+			}
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+
+			var recordSet networkingv1.DNSRecordSet
+			Expect(reconciler.Get(ctx, client.ObjectKey{Name: "ingress-" + ingress.Name, Namespace: namespace}, &recordSet)).To(Succeed())
+			return &recordSet
+		}
+
+		BeforeEach(func() {
+			provider = &fakeProvider{}
+			reconciler = nil
+			ingress = &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "hosts",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:   dnsapi.ProviderCloudflare,
+						sourceAnnotationKey: "dns-config",
+					},
+				},
+				Spec: k8snetworkingv1.IngressSpec{
+					Rules: []k8snetworkingv1.IngressRule{
+						{Host: "Shop.Example.com."},
+						{},
+						{Host: "shop.example.com"},
+						{Host: "*.apps.example.com"},
+					},
+					TLS: []k8snetworkingv1.IngressTLS{{Hosts: []string{"shop.example.com", "www.example.com"}}},
+				},
+			}
+			managerConfig = &networkingv1.DNSManagerConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: namespace},
+			}
+			objects = []client.Object{loadBalancer("traefik", "192.0.2.10"), cloudflareSource("dns-config", namespace)}
+		})
+
+		It("should normalize the hostnames and skip empty and repeated ones", func() {
+			Expect(ingressHosts(ingress, false)).To(Equal([]string{"shop.example.com", "*.apps.example.com"}))
+			Expect(ingressHosts(ingress, true)).To(Equal([]string{"shop.example.com", "*.apps.example.com", "www.example.com"}))
+
+			recordSet := reconcileIngress(ingress)
+			Expect(recordSet.Status.Records).To(HaveLen(2))
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("www.example.com", "A")).To(BeEmpty())
+		})
+
+		It("should publish the TLS hosts with includeTLSHosts", func() {
+			managerConfig.Spec.IncludeTLSHosts = true
+			reconcileIngress(ingress)
+
+			Expect(provider.content("www.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("www.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+		})
+
+		It("should publish wildcard records", func() {
+			reconcileIngress(ingress)
+
+			Expect(provider.content("*.apps.example.com", "A")).To(ConsistOf("192.0.2.10"))
+			Expect(provider.content("*.apps.example.com", "TXT")).To(ConsistOf(ownerTXTValue))
+		})
+
+		It("should fail wildcard hosts for providers without wildcard records", func() {
+			provider.noWildcards = true
+			recordSet := reconcileIngress(ingress)
+
+			Expect(provider.content("*.apps.example.com", "A")).To(BeEmpty())
+			Expect(recordSet.Status.Failures).To(HaveLen(1))
+			Expect(recordSet.Status.Failures[0].Host).To(Equal("*.apps.example.com"))
+			Expect(recordSet.Status.Failures[0].Permanent).To(BeTrue())
+		})
+
+		It("should fail wildcard hosts for zones configured without wildcard records", func() {
+			ingress.Annotations[typeAnnotationKey] = dnsapi.ProviderBind
+			ingress.Annotations[sourceAnnotationKey] = "bind-config"
+			ingress.Spec.Rules = []k8snetworkingv1.IngressRule{{Host: "*.apps.example.com"}}
+			objects = append(objects, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "bind-config", Namespace: namespace},
+				Data:       map[string]string{"bindServer": "127.0.0.1", "zone": "example.com", "wildcards": "false"},
+			})
+			// The BIND provider itself refuses, before it sends anything to the server
+			reconciler = newTestReconciler(namespace, provider, append(objects, ingress, managerConfig)...)
+			reconciler.NewProvider = dnsapi.NewProvider
+			recordSet := reconcileIngress(ingress)
+
+			Expect(recordSet.Status.Failures).To(HaveLen(1))
+			Expect(recordSet.Status.Failures[0].Host).To(Equal("*.apps.example.com"))
+			Expect(recordSet.Status.Failures[0].Message).To(ContainSubstring("does not support wildcard records"))
+			Expect(recordSet.Status.Failures[0].Permanent).To(BeTrue())
+		})
+
+		It("should not let TLS hosts take part in conflicts unless they are published", func() {
+			older := ingress.DeepCopy()
+			older.Name = "older"
+			older.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+			older.Spec.Rules = nil
+			older.Spec.TLS = []k8snetworkingv1.IngressTLS{{Hosts: []string{"Shop.Example.com"}}}
+			objects = append(objects, older)
+
+			recordSet := reconcileIngress(ingress)
+			Expect(recordSet.Status.Conflicts).To(BeEmpty())
+			Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		})
+	})
 })
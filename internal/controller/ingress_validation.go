@@ -0,0 +1,289 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+// IngressValidator checks the DNS annotations of an Ingress the way the IngressReconciler
+// uses them, so mistakes are rejected when the Ingress is applied instead of being logged.
+type IngressValidator struct {
+	client.Client
+	ConfigMapName      string
+	ConfigMapNamespace string
+
+	NewProvider ProviderFactory
+
+	// Scope restricts the Ingresses that are checked, like IngressReconciler.Scope.
+	Scope IngressScope
+}
+
+// reconciler returns an IngressReconciler that reads the same configuration as the validator.
+func (v *IngressValidator) reconciler() *IngressReconciler {
+	return &IngressReconciler{
+		Client:             v.Client,
+		ConfigMapName:      v.ConfigMapName,
+		ConfigMapNamespace: v.ConfigMapNamespace,
+		NewProvider:        v.NewProvider,
+		Scope:              v.Scope,
+	}
+}
+
+// ValidateIngress returns an Invalid error listing why the records of an Ingress could not be
+// published, and warnings for problems outside the Ingress. Ingresses without a provider are
+// not checked, and neither are Ingresses outside the scope.
+func (v *IngressValidator) ValidateIngress(ctx context.Context, ingress *networkingv1.Ingress) ([]string, error) {
+
+	if !v.Scope.Matches(ingress) {
+		return nil, nil
+	}
+
+	r := v.reconciler()
+	w := r.writer()
+
+	cfg, err := w.loadOperatorConfig(ctx)
+	if err != nil {
+		return []string{fmt.Sprintf("DNS annotations were not checked: %v", err)}, nil
+	}
+
+	annotations := field.NewPath("metadata", "annotations")
+	var allErrs field.ErrorList
+	var warnings []string
+
+	if value, found := ingress.Annotations[deletionPolicyAnnotation]; found && value != DeletionPolicyDelete && value != DeletionPolicyRetain {
+		allErrs = append(allErrs, field.NotSupported(annotations.Key(deletionPolicyAnnotation), value, []string{DeletionPolicyDelete, DeletionPolicyRetain}))
+	}
+	if value, found := ingress.Annotations[priorityAnnotation]; found {
+		if _, err := strconv.Atoi(value); err != nil {
+			allErrs = append(allErrs, field.Invalid(annotations.Key(priorityAnnotation), value, "must be an integer"))
+		}
+	}
+
+	ref, found, err := cfg.ingressProviderRef(ingress)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(annotations.Key(targetsAnnotationKey), ingress.Annotations[targetsAnnotationKey], err.Error()))
+		return warnings, invalidIngress(ingress, allErrs)
+	}
+	if !found {
+		_, hasType := ingress.Annotations[typeAnnotationKey]
+		_, hasSource := ingress.Annotations[sourceAnnotationKey]
+		switch {
+		case hasType:
+			allErrs = append(allErrs, field.Required(annotations.Key(sourceAnnotationKey), "required with "+typeAnnotationKey))
+		case hasSource:
+			allErrs = append(allErrs, field.Required(annotations.Key(typeAnnotationKey), "required with "+sourceAnnotationKey))
+		}
+		return warnings, invalidIngress(ingress, allErrs)
+	}
+
+	var providers []*resolvedProvider
+	if value, found := ingress.Annotations[targetsAnnotationKey]; found {
+		// Every binding of dns.configuration/targets is checked like a single provider
+		targetsPath := annotations.Key(targetsAnnotationKey)
+		bindings, _ := parseTargetBindings(value)
+		for _, binding := range bindings {
+			ref := binding.ref()
+			if ref.Kind == "" && ref.Type != dnsapi.ProviderCloudflare && ref.Type != dnsapi.ProviderBind {
+				allErrs = append(allErrs, field.NotSupported(targetsPath, ref.Type, []string{dnsapi.ProviderCloudflare, dnsapi.ProviderBind}))
+				continue
+			}
+			provider, err := w.provider(ctx, ingress.Namespace, ref, nil)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(targetsPath, value, fmt.Sprintf("%s: %v", refName(ref), err)))
+				continue
+			}
+			providers = append(providers, provider)
+
+			if _, _, err := bindingTargets(ctx, r.Client, binding, cfg); isPermanent(err) {
+				allErrs = append(allErrs, field.Invalid(targetsPath, value, fmt.Sprintf("%s: %v", refName(ref), err)))
+			} else if err != nil {
+				warnings = append(warnings, fmt.Sprintf("no DNS records are published with %s until a target has an address: %v", refName(ref), err))
+			}
+		}
+		if len(allErrs) > 0 {
+			return warnings, invalidIngress(ingress, allErrs)
+		}
+	} else {
+		// A default provider that cannot be used is a problem of the operator configuration
+		_, annotated := annotationProviderRef(ingress.Annotations)
+		refPath := annotations.Key(providerAnnotation(ref))
+
+		if ref.Kind == "" {
+			switch ref.Type {
+			case dnsapi.ProviderCloudflare, dnsapi.ProviderBind:
+			default:
+				allErrs = append(allErrs, field.NotSupported(annotations.Key(typeAnnotationKey), ref.Type, []string{dnsapi.ProviderCloudflare, dnsapi.ProviderBind}))
+				return warnings, invalidIngress(ingress, allErrs)
+			}
+		}
+
+		provider, err := w.provider(ctx, ingress.Namespace, ref, nil)
+		if err != nil {
+			if !annotated {
+				warnings = append(warnings, fmt.Sprintf("the default provider %s cannot be used: %v", refName(ref), err))
+				return warnings, invalidIngress(ingress, allErrs)
+			}
+			allErrs = append(allErrs, field.Invalid(refPath, ingress.Annotations[providerAnnotation(ref)], err.Error()))
+			return warnings, invalidIngress(ingress, allErrs)
+		}
+		providers = append(providers, provider)
+
+		// Without a target address yet the records are published once the Service or a node has one
+		if _, _, err := ingressTargets(ctx, r.Client, cfg); isPermanent(err) {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "rules"), err.Error()))
+		} else if err != nil {
+			warnings = append(warnings, fmt.Sprintf("no DNS records are published until a target has an address: %v", err))
+		}
+	}
+
+	// The hostnames are checked as the reconciler publishes them: normalized and, with
+	// includeTLSHosts, including the ones of spec.tls
+	for _, host := range ingressHosts(ingress, cfg.IncludeTLSHosts) {
+		if cfg.excludes(host) {
+			continue
+		}
+		hostPath := ingressHostPath(ingress, host)
+
+		if err := checkHost(providers, host); err != nil {
+			allErrs = append(allErrs, field.Forbidden(hostPath, err.Error()))
+			continue
+		}
+
+		owner, err := hostOwner(ctx, v.Client, host, cfg)
+		if err != nil {
+			return warnings, err
+		}
+		if owner != nil && owner.Namespace != ingress.Namespace {
+			allErrs = append(allErrs, field.Forbidden(hostPath, fmt.Sprintf("%s is already published by Ingress %s", host, client.ObjectKeyFromObject(owner))))
+		}
+	}
+
+	// Generated hostnames are only warned about; with generateName the name is not known yet
+	if len(ingressHosts(ingress, cfg.IncludeTLSHosts)) > 0 || ingress.Name == "" {
+		return warnings, invalidIngress(ingress, allErrs)
+	}
+	hosts, err := cfg.generatedHosts(ingress, "Ingress")
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("no hostnames are published: %v", err))
+	}
+	for _, host := range hosts {
+		if cfg.excludes(host) {
+			continue
+		}
+		if err := checkHost(providers, host); err != nil {
+			warnings = append(warnings, fmt.Sprintf("generated hostname %s is not published: %v", host, err))
+			continue
+		}
+		owner, err := hostOwner(ctx, v.Client, host, cfg)
+		if err != nil {
+			return warnings, err
+		}
+		if owner != nil && client.ObjectKeyFromObject(owner) != client.ObjectKeyFromObject(ingress) {
+			warnings = append(warnings, fmt.Sprintf("generated hostname %s is already published by Ingress %s", host, client.ObjectKeyFromObject(owner)))
+		}
+	}
+
+	return warnings, invalidIngress(ingress, allErrs)
+}
+
+// ingressHostPath returns the path of the rule or spec.tls entry that declares a normalized
+// hostname of an Ingress.
+func ingressHostPath(ingress *networkingv1.Ingress, host string) *field.Path {
+
+	for i, rule := range ingress.Spec.Rules {
+		if normalizeHost(rule.Host) == host {
+			return field.NewPath("spec", "rules").Index(i).Child("host")
+		}
+	}
+	for i, entry := range ingress.Spec.TLS {
+		for j, tlsHost := range entry.Hosts {
+			if normalizeHost(tlsHost) == host {
+				return field.NewPath("spec", "tls").Index(i).Child("hosts").Index(j)
+			}
+		}
+	}
+
+	return field.NewPath("spec", "rules")
+}
+
+// ValidateIngressUpdate validates an updated Ingress. Updates that leave the rules, spec.tls and
+// the DNS annotations alone, like the reconciler adding its finalizer, are not checked again.
+func (v *IngressValidator) ValidateIngressUpdate(ctx context.Context, oldIngress *networkingv1.Ingress, ingress *networkingv1.Ingress) ([]string, error) {
+
+	if !ingress.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	changed := !equality.Semantic.DeepEqual(oldIngress.Spec.Rules, ingress.Spec.Rules) || !equality.Semantic.DeepEqual(oldIngress.Spec.TLS, ingress.Spec.TLS)
+	for _, key := range []string{typeAnnotationKey, sourceAnnotationKey, providerAnnotationKey, clusterProviderAnnotationKey, targetsAnnotationKey, deletionPolicyAnnotation, priorityAnnotation} {
+		if oldIngress.Annotations[key] != ingress.Annotations[key] {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	return v.ValidateIngress(ctx, ingress)
+}
+
+// checkHost returns the first reason one of providers cannot publish a host.
+func checkHost(providers []*resolvedProvider, host string) error {
+
+	for _, provider := range providers {
+		if err := provider.checkHost(host); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// providerAnnotation returns the annotation that selects a provider reference.
+func providerAnnotation(ref dnsv1.ProviderReference) string {
+
+	switch ref.Kind {
+	case dnsv1.KindDNSProvider:
+		return providerAnnotationKey
+	case dnsv1.KindClusterDNSProvider:
+		return clusterProviderAnnotationKey
+	default:
+		return sourceAnnotationKey
+	}
+}
+
+// invalidIngress returns the Invalid error for a list of field errors, nil if there are none.
+func invalidIngress(ingress *networkingv1.Ingress, allErrs field.ErrorList) error {
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return errors.NewInvalid(networkingv1.SchemeGroupVersion.WithKind("Ingress").GroupKind(), ingress.Name, allErrs)
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("Ingress validation", func() {
+	const namespace = "shop"
+
+	ctx := context.Background()
+
+	var (
+		ingress *k8snetworkingv1.Ingress
+		objects []client.Object
+	)
+
+	validate := func() ([]string, error) {
+		validator := &IngressValidator{
+			Client:             newFakeClient(objects...),
+			ConfigMapName:      "dns-operator-config",
+			ConfigMapNamespace: "kube-system",
+		}
+		return validator.ValidateIngress(ctx, ingress)
+	}
+
+	BeforeEach(func() {
+		ingress = &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: namespace,
+				Annotations: map[string]string{
+					typeAnnotationKey:   dnsapi.ProviderCloudflare,
+					sourceAnnotationKey: "cloudflare-config",
+				},
+			},
+			Spec: k8snetworkingv1.IngressSpec{
+				Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}},
+			},
+		}
+		objects = []client.Object{
+			loadBalancer("traefik", "192.0.2.10"),
+			cloudflareSource("cloudflare-config", "kube-system"),
+		}
+	})
+
+	It("should accept valid DNS annotations", func() {
+		warnings, err := validate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("should accept Ingresses without DNS annotations", func() {
+		ingress.Annotations = nil
+		_, err := validate()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject unknown provider types", func() {
+		ingress.Annotations[typeAnnotationKey] = "cloudflair"
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(typeAnnotationKey))
+	})
+
+	It("should reject a missing source", func() {
+		delete(ingress.Annotations, sourceAnnotationKey)
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(sourceAnnotationKey))
+	})
+
+	It("should reject a source that does not exist", func() {
+		ingress.Annotations[sourceAnnotationKey] = "missing"
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("missing"))
+	})
+
+	It("should reject an invalid TTL in the source", func() {
+		objects[1].(*corev1.ConfigMap).Data["ttl"] = "0"
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("invalid ttl"))
+	})
+
+	It("should reject an invalid deletion policy", func() {
+		ingress.Annotations[deletionPolicyAnnotation] = "keep"
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("should reject a target address that is not an IP address", func() {
+		objects[0].(*corev1.Service).Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{Hostname: "lb.example.net"}}
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("should only warn while the target service has no address", func() {
+		objects[0].(*corev1.Service).Status.LoadBalancer.Ingress = nil
+		warnings, err := validate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+	})
+
+	It("should reject hostnames outside the zones of the provider", func() {
+		ingress.Annotations = map[string]string{providerAnnotationKey: "example-com"}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, k8snetworkingv1.IngressRule{Host: "shop.example.org"})
+		objects = append(objects,
+			&networkingv1.DNSProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "example-com", Namespace: namespace},
+				Spec: networkingv1.DNSProviderSpec{
+					Cloudflare: &networkingv1.CloudflareProviderSpec{
+						ZoneID:            "zone",
+						APITokenSecretRef: networkingv1.SecretKeySelector{Name: "cloudflare-token", Key: "token"},
+					},
+					Zones: []string{"example.com"},
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloudflare-token", Namespace: namespace},
+				Data:       map[string][]byte{"token": []byte("secret-token")},
+			},
+		)
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.rules[1].host"))
+		Expect(err.Error()).NotTo(ContainSubstring("spec.rules[0].host"))
+	})
+
+	It("should reject hostnames published from another namespace", func() {
+		objects = append(objects, &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other", Annotations: ingress.Annotations},
+			Spec:       ingress.Spec,
+		})
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("other/web"))
+	})
+
+	It("should reject hostnames published from another namespace in any spelling", func() {
+		objects = append(objects, &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other", Annotations: ingress.Annotations},
+			Spec:       ingress.Spec,
+		})
+		ingress.Spec.Rules = []k8snetworkingv1.IngressRule{{Host: "Shop.Example.com."}}
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.rules[0].host"))
+		Expect(err.Error()).To(ContainSubstring("other/web"))
+	})
+
+	It("should check the TLS hosts with includeTLSHosts", func() {
+		objects = append(objects,
+			&k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "secure", Namespace: "other", Annotations: ingress.Annotations},
+				Spec:       k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "secure.example.com"}}},
+			},
+			&networkingv1.DNSManagerConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+				Spec:       networkingv1.DNSManagerConfigSpec{IncludeTLSHosts: true},
+			},
+		)
+		ingress.Spec.TLS = []k8snetworkingv1.IngressTLS{{Hosts: []string{"shop.example.com", "secure.example.com"}}}
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.tls[0].hosts[1]"))
+		Expect(err.Error()).To(ContainSubstring("other/secure"))
+	})
+
+	It("should accept hostnames shared within the namespace", func() {
+		objects = append(objects, &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: namespace, Annotations: ingress.Annotations},
+			Spec:       ingress.Spec,
+		})
+		_, err := validate()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject an invalid targets annotation", func() {
+		ingress.Annotations = map[string]string{targetsAnnotationKey: "- type: cloudflare\n"}
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(targetsAnnotationKey))
+	})
+
+	It("should check every provider of the targets annotation", func() {
+		ingress.Annotations = map[string]string{targetsAnnotationKey: "- type: cloudflare\n  source: cloudflare-config\n- type: bind\n  source: missing\n"}
+		_, err := validate()
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("missing"))
+
+		ingress.Annotations[targetsAnnotationKey] = "- type: cloudflare\n  source: cloudflare-config\n  targetService: kube-system/traefik\n"
+		warnings, err := validate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("should not check updates that leave the DNS settings alone", func() {
+		ingress.Annotations[typeAnnotationKey] = "cloudflair"
+		updated := ingress.DeepCopy()
+		updated.Finalizers = []string{cleanupFinalizer}
+
+		validator := &IngressValidator{Client: newFakeClient(objects...), ConfigMapName: "dns-operator-config", ConfigMapNamespace: "kube-system"}
+		_, err := validator.ValidateIngressUpdate(ctx, ingress, updated)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated.Spec.Rules = append(updated.Spec.Rules, k8snetworkingv1.IngressRule{Host: "store.example.com"})
+		_, err = validator.ValidateIngressUpdate(ctx, ingress, updated)
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,159 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var (
+	providerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_dns_manager_provider_requests_total",
+		Help: "Number of DNS provider API requests by provider, operation and result.",
+	}, []string{"provider", "operation", "result"})
+
+	providerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_dns_manager_provider_request_duration_seconds",
+		Help:    "Latency of DNS provider API requests by provider and operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "operation"})
+
+	providerRateLimits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_dns_manager_provider_rate_limited_total",
+		Help: "Number of DNS provider API requests rejected by a rate limit.",
+	}, []string{"provider"})
+
+	driftRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_dns_manager_drift_repairs_total",
+		Help: "Number of records that were changed outside kube-dns-manager and written again.",
+	}, []string{"provider", "zone"})
+
+	lastSuccessfulSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_dns_manager_last_successful_sync_timestamp_seconds",
+		Help: "Time of the last reconcile that wrote the records of a zone without errors.",
+	}, []string{"zone"})
+)
+
+var (
+	managedRecordsDesc = prometheus.NewDesc("kube_dns_manager_managed_records",
+		"Number of DNS records managed by kube-dns-manager by zone and type.", []string{"zone", "type"}, nil)
+	hostConflictsDesc = prometheus.NewDesc("kube_dns_manager_host_conflicts",
+		"Number of hostnames that are not published because another object owns them.", nil, nil)
+	failedHostsDesc = prometheus.NewDesc("kube_dns_manager_failed_hosts",
+		"Number of hostnames whose last reconcile failed.", nil, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(providerRequests, providerRequestDuration, providerRateLimits, driftRepairs, lastSuccessfulSync)
+}
+
+// instrumentedProvider records metrics for every request of a DNS provider.
+type instrumentedProvider struct {
+	dnsapi.Provider
+	name string
+}
+
+func (p *instrumentedProvider) GetRecords(name string, rtype string) ([]dnsapi.Record, error) {
+	start := time.Now()
+	records, err := p.Provider.GetRecords(name, rtype)
+	p.observe("get", start, err)
+	return records, err
+}
+
+func (p *instrumentedProvider) AddRecord(name string, rtype string, content string) (dnsapi.Record, error) {
+	start := time.Now()
+	record, err := p.Provider.AddRecord(name, rtype, content)
+	p.observe("create", start, err)
+	return record, err
+}
+
+func (p *instrumentedProvider) UpdateRecord(record dnsapi.Record, content string) error {
+	start := time.Now()
+	err := p.Provider.UpdateRecord(record, content)
+	p.observe("update", start, err)
+	return err
+}
+
+func (p *instrumentedProvider) DeleteRecord(record dnsapi.Record) error {
+	start := time.Now()
+	err := p.Provider.DeleteRecord(record)
+	p.observe("delete", start, err)
+	return err
+}
+
+func (p *instrumentedProvider) observe(operation string, start time.Time, err error) {
+
+	providerRequestDuration.WithLabelValues(p.name, operation).Observe(time.Since(start).Seconds())
+
+	result := "success"
+	if err != nil {
+		result = "error"
+		if dnsapi.IsRateLimited(err) {
+			providerRateLimits.WithLabelValues(p.name).Inc()
+		}
+	}
+	providerRequests.WithLabelValues(p.name, operation, result).Inc()
+}
+
+// recordSetCollector reports the records, conflicts and failures of all DNSRecordSets.
+// It reads them from the cache when metrics are scraped, so the numbers are never stale.
+type recordSetCollector struct {
+	client client.Reader
+}
+
+func (c *recordSetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedRecordsDesc
+	ch <- hostConflictsDesc
+	ch <- failedHostsDesc
+}
+
+func (c *recordSetCollector) Collect(ch chan<- prometheus.Metric) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var recordSets dnsv1.DNSRecordSetList
+	if err := c.client.List(ctx, &recordSets); err != nil {
+		ch <- prometheus.NewInvalidMetric(managedRecordsDesc, err)
+		return
+	}
+
+	type zoneType struct{ zone, rtype string }
+	records := map[zoneType]int{}
+	var conflicts, failures int
+	for _, recordSet := range recordSets.Items {
+		for _, record := range recordSet.Status.Records {
+			records[zoneType{record.Zone, record.Type}]++
+		}
+		conflicts += len(recordSet.Status.Conflicts)
+		failures += len(recordSet.Status.Failures)
+	}
+
+	for key, count := range records {
+		ch <- prometheus.MustNewConstMetric(managedRecordsDesc, prometheus.GaugeValue, float64(count), key.zone, key.rtype)
+	}
+	ch <- prometheus.MustNewConstMetric(hostConflictsDesc, prometheus.GaugeValue, float64(conflicts))
+	ch <- prometheus.MustNewConstMetric(failedHostsDesc, prometheus.GaugeValue, float64(failures))
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+// nodeTargets returns the record type and the addresses of the Ready nodes the targetNodes
+// of the configuration select. IPv4 addresses are published as A records; AAAA records are
+// only published if there are none.
+func nodeTargets(ctx context.Context, c client.Reader, cfg operatorConfig) (string, []string, error) {
+
+	var nodes corev1.NodeList
+	if err := c.List(ctx, &nodes, client.MatchingLabelsSelector{Selector: cfg.nodeSelector}); err != nil {
+		return "", nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	addressType := corev1.NodeAddressType(cfg.TargetNodes.AddressType)
+	var addresses []string
+	for _, node := range nodes.Items {
+		if !nodeReady(&node) {
+			continue
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type == addressType && !containsString(addresses, address.Address) {
+				addresses = append(addresses, address.Address)
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return "", nil, fmt.Errorf("no Ready node with an %s address matches the targetNodes selector", addressType)
+	}
+
+	return addressTargets(addresses)
+}
+
+// nodeReady reports whether the Ready condition of a node is true.
+func nodeReady(node *corev1.Node) bool {
+
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// nodeTargetChanged passes node events that can change the node targets: nodes joining or
+// leaving, and changes of their labels, readiness or addresses. Heartbeats are dropped.
+var nodeTargetChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		newNode, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		return nodeReady(oldNode) != nodeReady(newNode) ||
+			!reflect.DeepEqual(oldNode.Labels, newNode.Labels) ||
+			!reflect.DeepEqual(oldNode.Status.Addresses, newNode.Status.Addresses)
+	},
+}
+
+// publishedObjects returns a request for every object of a list that carries the cleanup
+// finalizer, i.e. may have published records.
+func publishedObjects(ctx context.Context, c client.Reader, list client.ObjectList) []reconcile.Request {
+
+	if err := c.List(ctx, list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list objects for node targets")
+		return nil
+	}
+	items, _ := meta.ExtractList(list)
+
+	var requests []reconcile.Request
+	for _, item := range items {
+		obj := item.(client.Object)
+		if controllerutil.ContainsFinalizer(obj, cleanupFinalizer) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+		}
+	}
+
+	return requests
+}
+
+// objectsForNode maps a node to the objects of the reconciler's kind if their records point
+// to the nodes.
+func (r *sourceReconciler) objectsForNode(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	cfg, err := r.writer().loadOperatorConfig(ctx)
+	if err != nil || cfg.TargetNodes == nil {
+		return nil
+	}
+
+	return publishedObjects(ctx, r.Client, r.source.newList())
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("Node targets", func() {
+	const namespace = "shop"
+
+	ctx := context.Background()
+
+	var (
+		provider      *fakeProvider
+		reconciler    *IngressReconciler
+		ingress       *k8snetworkingv1.Ingress
+		managerConfig *networkingv1.DNSManagerConfig
+		objects       []client.Object
+	)
+
+	newNode := func(name string, ready bool, labels map[string]string, externalIP string) *corev1.Node {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeExternalIP, Address: externalIP},
+					{Type: corev1.NodeInternalIP, Address: "10.0.0." + name[len(name)-1:]},
+					{Type: corev1.NodeHostName, Address: name},
+				},
+			},
+		}
+	}
+
+	reconcileIngress := func() *networkingv1.DNSRecordSet {
+		if reconciler == nil {
+			reconciler = newTestReconciler("kube-system", provider, append(objects, ingress, managerConfig)...)
+		}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+
+		var recordSet networkingv1.DNSRecordSet
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: "ingress-web", Namespace: namespace}, &recordSet)).To(Succeed())
+		return &recordSet
+	}
+
+	BeforeEach(func() {
+		provider = &fakeProvider{}
+		reconciler = nil
+		ingress = &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: namespace,
+				Annotations: map[string]string{
+					typeAnnotationKey:   dnsapi.ProviderCloudflare,
+					sourceAnnotationKey: "cloudflare-config",
+				},
+			},
+			Spec: k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}}},
+		}
+		managerConfig = &networkingv1.DNSManagerConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "dns-operator-config", Namespace: "kube-system"},
+			Spec: networkingv1.DNSManagerConfigSpec{
+				TargetNodes: &networkingv1.NodeTargets{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"ingress": "true"}},
+				},
+			},
+		}
+		edge := map[string]string{"ingress": "true"}
+		objects = []client.Object{
+			newNode("edge-1", true, edge, "192.0.2.41"),
+			newNode("edge-2", true, edge, "192.0.2.42"),
+			newNode("edge-3", false, edge, "192.0.2.43"),
+			newNode("worker-4", true, nil, "192.0.2.44"),
+			cloudflareSource("cloudflare-config", "kube-system"),
+		}
+	})
+
+	It("should publish the external addresses of the Ready selected nodes", func() {
+		recordSet := reconcileIngress()
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.41", "192.0.2.42"))
+		Expect(recordSet.Status.Records[0].Target).To(Equal("192.0.2.41,192.0.2.42"))
+	})
+
+	It("should publish the internal addresses if configured", func() {
+		managerConfig.Spec.TargetNodes.AddressType = string(corev1.NodeInternalIP)
+		reconcileIngress()
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("10.0.0.1", "10.0.0.2"))
+	})
+
+	It("should follow nodes that become NotReady", func() {
+		reconcileIngress()
+
+		var node corev1.Node
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: "edge-2"}, &node)).To(Succeed())
+		node.Status.Conditions[0].Status = corev1.ConditionFalse
+		Expect(reconciler.Status().Update(ctx, &node)).To(Succeed())
+		reconcileIngress()
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.41"))
+	})
+
+	It("should report the hosts as failed without Ready nodes", func() {
+		managerConfig.Spec.TargetNodes.Selector.MatchLabels = map[string]string{"ingress": "none"}
+		recordSet := reconcileIngress()
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(recordSet.Status.Failures).To(HaveLen(1))
+		Expect(recordSet.Status.Failures[0].Message).To(ContainSubstring("no Ready node with an ExternalIP address"))
+	})
+
+	It("should reject invalid node targets", func() {
+		_, err := parseManagerConfig(networkingv1.DNSManagerConfigSpec{TargetNodes: &networkingv1.NodeTargets{AddressType: "Hostname"}})
+		Expect(err).To(HaveOccurred())
+
+		_, err = parseManagerConfig(networkingv1.DNSManagerConfigSpec{TargetNodes: &networkingv1.NodeTargets{
+			Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "ingress", Operator: "Maybe"}}},
+		}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should only pass node changes that can change the targets", func() {
+		node := newNode("edge-1", true, nil, "192.0.2.41")
+		heartbeat := node.DeepCopy()
+		heartbeat.Status.Conditions[0].LastHeartbeatTime = metav1.Now()
+		Expect(nodeTargetChanged.Update(event.UpdateEvent{ObjectOld: node, ObjectNew: heartbeat})).To(BeFalse())
+
+		notReady := node.DeepCopy()
+		notReady.Status.Conditions[0].Status = corev1.ConditionUnknown
+		Expect(nodeTargetChanged.Update(event.UpdateEvent{ObjectOld: node, ObjectNew: notReady})).To(BeTrue())
+
+		labeled := node.DeepCopy()
+		labeled.Labels = map[string]string{"ingress": "true"}
+		Expect(nodeTargetChanged.Update(event.UpdateEvent{ObjectOld: node, ObjectNew: labeled})).To(BeTrue())
+	})
+
+	It("should map nodes to the published Ingresses only with node targets", func() {
+		reconcileIngress()
+		Expect(reconciler.ingressesForNode(ctx, objects[0])).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)}))
+
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(managerConfig), managerConfig)).To(Succeed())
+		managerConfig.Spec.TargetNodes = nil
+		Expect(reconciler.Update(ctx, managerConfig)).To(Succeed())
+		Expect(reconciler.ingressesForNode(ctx, objects[0])).To(BeEmpty())
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// +kubebuilder:rbac:groups=networking.tytik.cloud,resources=dnszonepolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// namespacePolicy holds the DNSZonePolicies that select a namespace. Without any, the
+// namespace may publish everything.
+type namespacePolicy struct {
+	namespace string
+	policies  []dnsv1.DNSZonePolicy
+	// sourceNamespace is the namespace of the sources the policies name without a namespace.
+	sourceNamespace string
+}
+
+// check returns a permanent error unless one of the policies allows publishing host with
+// the provider ref selects.
+func (p namespacePolicy) check(ref dnsv1.ProviderReference, host string) error {
+
+	if len(p.policies) == 0 {
+		return nil
+	}
+
+	for _, policy := range p.policies {
+		if allowsProvider(policy.Spec, ref, p.sourceNamespace) && (len(policy.Spec.Domains) == 0 || inZones(host, policy.Spec.Domains)) {
+			return nil
+		}
+	}
+
+	return permanent(fmt.Errorf("no DNSZonePolicy allows namespace %s to publish %s with %s", p.namespace, host, refName(ref)))
+}
+
+// allowsProvider reports whether a policy allows the provider ref selects. ref is normalized,
+// see normalizeRef; sources of the policy without a namespace are in sourceNamespace.
+func allowsProvider(spec dnsv1.DNSZonePolicySpec, ref dnsv1.ProviderReference, sourceNamespace string) bool {
+
+	if len(spec.Providers) == 0 {
+		return true
+	}
+
+	for _, allowed := range spec.Providers {
+		if allowed.Kind != ref.Kind {
+			continue
+		}
+		if ref.Kind != "" && allowed.Name == ref.Name || ref.Kind == "" && allowed.Type == ref.Type && qualifySource(allowed.Source, sourceNamespace) == ref.Source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// namespacePolicy returns the DNSZonePolicies that select namespace. Objects without a
+// namespace, which only cluster-scoped sources would have, are not restricted.
+func (w *recordWriter) namespacePolicy(ctx context.Context, namespace string) (namespacePolicy, error) {
+
+	result := namespacePolicy{namespace: namespace, sourceNamespace: w.ConfigMapNamespace}
+	if namespace == "" {
+		return result, nil
+	}
+
+	var policies dnsv1.DNSZonePolicyList
+	if err := w.List(ctx, &policies); err != nil {
+		return result, fmt.Errorf("failed to list DNSZonePolicies: %w", err)
+	}
+	if len(policies.Items) == 0 {
+		return result, nil
+	}
+
+	var ns corev1.Namespace
+	if err := w.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return result, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+
+	for _, policy := range policies.Items {
+		selected, err := selectsNamespace(policy.Spec, &ns)
+		if err != nil {
+			return result, permanent(fmt.Errorf("invalid DNSZonePolicy %s: %w", policy.Name, err))
+		}
+		if selected {
+			result.policies = append(result.policies, policy)
+		}
+	}
+
+	return result, nil
+}
+
+// selectsNamespace reports whether a policy applies to a namespace.
+func selectsNamespace(spec dnsv1.DNSZonePolicySpec, ns *corev1.Namespace) (bool, error) {
+
+	if containsString(spec.Namespaces, ns.Name) {
+		return true, nil
+	}
+	if spec.NamespaceSelector == nil {
+		return false, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+var _ = Describe("DNSZonePolicy", func() {
+	const namespace = "shop"
+
+	ctx := context.Background()
+
+	var (
+		provider *fakeProvider
+		ingress  *k8snetworkingv1.Ingress
+		policy   *networkingv1.DNSZonePolicy
+		objects  []client.Object
+	)
+
+	allObjects := func() []client.Object {
+		if policy != nil {
+			return append(objects, policy, ingress)
+		}
+		return append(objects, ingress)
+	}
+
+	reconcileIngress := func() *networkingv1.DNSRecordSet {
+		reconciler := newTestReconciler("kube-system", provider, allObjects()...)
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+
+		var recordSet networkingv1.DNSRecordSet
+		key := types.NamespacedName{Name: "ingress-" + ingress.Name, Namespace: namespace}
+		Expect(reconciler.Get(ctx, key, &recordSet)).To(Succeed())
+		return &recordSet
+	}
+
+	BeforeEach(func() {
+		provider = &fakeProvider{}
+		ingress = &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web",
+				Namespace:   namespace,
+				Annotations: map[string]string{clusterProviderAnnotationKey: "cloudflare"},
+			},
+			Spec: k8snetworkingv1.IngressSpec{
+				Rules: []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}, {Host: "blog.example.com"}},
+			},
+		}
+		policy = &networkingv1.DNSZonePolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-shop"},
+			Spec: networkingv1.DNSZonePolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "shop"}},
+				Providers:         []networkingv1.ProviderReference{{Kind: networkingv1.KindClusterDNSProvider, Name: "cloudflare"}},
+				Domains:           []string{"shop.example.com"},
+			},
+		}
+		objects = []client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{"team": "shop"}}},
+			loadBalancer("traefik", "192.0.2.10"),
+			&networkingv1.ClusterDNSProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloudflare"},
+				Spec: networkingv1.DNSProviderSpec{
+					Cloudflare: &networkingv1.CloudflareProviderSpec{
+						ZoneID:            "zone",
+						APITokenSecretRef: networkingv1.SecretKeySelector{Name: "cloudflare-token", Key: "token"},
+					},
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloudflare-token", Namespace: "kube-system"},
+				Data:       map[string][]byte{"token": []byte("secret-token")},
+			},
+		}
+	})
+
+	It("should only publish the domains the policy allows", func() {
+		recordSet := reconcileIngress()
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(provider.content("blog.example.com", "A")).To(BeEmpty())
+		Expect(recordSet.Status.Failures).To(HaveLen(1))
+		Expect(recordSet.Status.Failures[0].Host).To(Equal("blog.example.com"))
+		Expect(recordSet.Status.Failures[0].Permanent).To(BeTrue())
+		Expect(recordSet.Status.Failures[0].Message).To(ContainSubstring("DNSZonePolicy"))
+	})
+
+	It("should not publish with a provider the policy does not allow", func() {
+		policy.Spec.Providers = []networkingv1.ProviderReference{{Kind: networkingv1.KindClusterDNSProvider, Name: "bind"}}
+		recordSet := reconcileIngress()
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(recordSet.Status.Failures).To(HaveLen(2))
+	})
+
+	It("should allow what any selecting policy allows", func() {
+		objects = append(objects, &networkingv1.DNSZonePolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "blog"},
+			Spec: networkingv1.DNSZonePolicySpec{
+				Namespaces: []string{namespace},
+				Domains:    []string{"blog.example.com"},
+			},
+		})
+		reconcileIngress()
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(provider.content("blog.example.com", "A")).To(ConsistOf("192.0.2.10"))
+	})
+
+	It("should not restrict namespaces no policy selects", func() {
+		policy.Spec.NamespaceSelector.MatchLabels = map[string]string{"team": "blog"}
+		reconcileIngress()
+
+		Expect(provider.content("blog.example.com", "A")).To(ConsistOf("192.0.2.10"))
+	})
+
+	It("should not restrict anything without policies", func() {
+		policy = nil
+		reconcileIngress()
+
+		Expect(provider.content("blog.example.com", "A")).To(ConsistOf("192.0.2.10"))
+	})
+
+	It("should reject Ingresses the policy does not allow in the webhook", func() {
+		validator := &IngressValidator{
+			Client:             newFakeClient(allObjects()...),
+			ConfigMapName:      "dns-operator-config",
+			ConfigMapNamespace: "kube-system",
+		}
+		_, err := validator.ValidateIngress(ctx, ingress)
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.rules[1].host"))
+		Expect(err.Error()).NotTo(ContainSubstring("spec.rules[0].host"))
+	})
+})
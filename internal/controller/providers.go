@@ -0,0 +1,236 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+// resolvedProvider is a DNS provider together with the reference that selected it.
+type resolvedProvider struct {
+	dnsapi.Provider
+	// ptype is the provider type, e.g. cloudflare
+	ptype string
+	ref   dnsv1.ProviderReference
+	// zones the provider may write to, all if empty
+	zones []string
+	// policy of the namespace the provider is used for
+	policy namespacePolicy
+	// wildcards reports whether the provider can publish wildcard records
+	wildcards bool
+}
+
+// checkHost returns a permanent error if the provider may not write records for host, or
+// the namespace it is used for may not publish host with it.
+func (p *resolvedProvider) checkHost(host string) error {
+
+	if strings.HasPrefix(host, "*.") && !p.wildcards {
+		return permanent(fmt.Errorf("%s does not support wildcard records such as %s", refName(p.ref), host))
+	}
+	if len(p.zones) > 0 && !inZones(host, p.zones) {
+		return permanent(fmt.Errorf("%s is not in the zones %s of %s", host, strings.Join(p.zones, ", "), refName(p.ref)))
+	}
+
+	return p.policy.check(p.ref, host)
+}
+
+// managedRecord returns the state of a record written with the provider.
+func (p *resolvedProvider) managedRecord(host string, rtype string, target string, ids []string) dnsv1.ManagedRecord {
+
+	record := dnsv1.ManagedRecord{
+		Host:      host,
+		Type:      rtype,
+		Target:    target,
+		Provider:  p.ptype,
+		Source:    p.ref.Source,
+		Zone:      p.Zone(),
+		RecordIDs: ids,
+	}
+	if p.ref.Kind != "" {
+		record.ProviderKind = p.ref.Kind
+		record.Source = p.ref.Name
+	}
+
+	return record
+}
+
+// recordProvider returns the reference of the provider a record was written with. A bare
+// source name, recorded by earlier versions, names a source in the operator namespace.
+func (w *recordWriter) recordProvider(record dnsv1.ManagedRecord) dnsv1.ProviderReference {
+
+	if record.ProviderKind != "" {
+		return dnsv1.ProviderReference{Kind: record.ProviderKind, Name: record.Source}
+	}
+
+	return dnsv1.ProviderReference{Type: record.Provider, Source: qualifySource(record.Source, w.ConfigMapNamespace)}
+}
+
+// refName describes a provider reference in messages.
+func refName(ref dnsv1.ProviderReference) string {
+
+	if ref.Kind != "" {
+		return ref.Kind + " " + ref.Name
+	}
+
+	return ref.Source
+}
+
+// inZones reports whether host is one of the zones or a subdomain of one.
+func inZones(host string, zones []string) bool {
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, zone := range zones {
+		zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+		if host == zone || strings.HasSuffix(host, "."+zone) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// providerConfig returns the type, configuration and allowed zones of the provider a
+// reference selects. A DNSProvider is looked up in namespace.
+func (w *recordWriter) providerConfig(ctx context.Context, namespace string, ref dnsv1.ProviderReference) (string, map[string]string, []string, error) {
+
+	switch ref.Kind {
+	case "":
+		key, err := w.sourceKey(namespace, ref.Source)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		// A missing source is transient, it may be created after the object
+		dnsconfig, err := w.loadDNSConfiguration(ctx, key)
+		return ref.Type, dnsconfig, nil, err
+	case dnsv1.KindDNSProvider:
+		var dnsProvider dnsv1.DNSProvider
+		if err := w.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &dnsProvider); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to get DNSProvider %s: %w", ref.Name, err)
+		}
+		ptype, dnsconfig, err := w.specConfig(ctx, dnsProvider.Spec, namespace)
+		return ptype, dnsconfig, dnsProvider.Spec.Zones, err
+	case dnsv1.KindClusterDNSProvider:
+		var dnsProvider dnsv1.ClusterDNSProvider
+		if err := w.Get(ctx, client.ObjectKey{Name: ref.Name}, &dnsProvider); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to get ClusterDNSProvider %s: %w", ref.Name, err)
+		}
+		ptype, dnsconfig, err := w.specConfig(ctx, dnsProvider.Spec, "")
+		return ptype, dnsconfig, dnsProvider.Spec.Zones, err
+	}
+
+	return "", nil, nil, permanent(fmt.Errorf("unknown provider kind %s", ref.Kind))
+}
+
+// specConfig turns a DNSProvider spec into the configuration NewProvider expects. Secrets are
+// read from namespace, or for a ClusterDNSProvider (empty namespace) from the namespace the
+// selector names.
+func (w *recordWriter) specConfig(ctx context.Context, spec dnsv1.DNSProviderSpec, namespace string) (string, map[string]string, error) {
+
+	var ptype string
+	dnsconfig := map[string]string{}
+
+	switch {
+	case spec.Cloudflare != nil:
+		token, err := w.secretValue(ctx, namespace, spec.Cloudflare.APITokenSecretRef)
+		if err != nil {
+			return "", nil, err
+		}
+		ptype = dnsapi.ProviderCloudflare
+		dnsconfig["zoneid"] = spec.Cloudflare.ZoneID
+		dnsconfig["token"] = token
+		dnsconfig["proxied"] = strconv.FormatBool(spec.Cloudflare.Proxied)
+	case spec.RFC2136 != nil:
+		hmacKey, err := w.secretValue(ctx, namespace, spec.RFC2136.TSIGSecretRef)
+		if err != nil {
+			return "", nil, err
+		}
+		ptype = dnsapi.ProviderBind
+		dnsconfig["bindServer"] = spec.RFC2136.Server
+		dnsconfig["zone"] = spec.RFC2136.Zone
+		dnsconfig["hmackey"] = hmacKey
+		if spec.RFC2136.Port > 0 {
+			dnsconfig["bindPort"] = strconv.Itoa(int(spec.RFC2136.Port))
+		}
+		if spec.RFC2136.TSIGKeyName != "" {
+			dnsconfig["keyname"] = spec.RFC2136.TSIGKeyName
+		}
+	default:
+		return "", nil, permanent(fmt.Errorf("no provider configured"))
+	}
+
+	if spec.TTL > 0 {
+		dnsconfig["ttl"] = strconv.FormatInt(spec.TTL, 10)
+	}
+
+	return ptype, dnsconfig, nil
+}
+
+// secretValue reads a key of the Secret a selector names. A missing Secret is transient,
+// a missing key is not.
+func (w *recordWriter) secretValue(ctx context.Context, namespace string, selector dnsv1.SecretKeySelector) (string, error) {
+
+	namespace = w.secretNamespace(namespace, selector)
+
+	var secret corev1.Secret
+	if err := w.Get(ctx, client.ObjectKey{Namespace: namespace, Name: selector.Name}, &secret); err != nil {
+		return "", fmt.Errorf("failed to get Secret %s/%s: %w", namespace, selector.Name, err)
+	}
+
+	value, found := secret.Data[selector.Key]
+	if !found {
+		return "", permanent(fmt.Errorf("secret %s/%s has no key %s", namespace, selector.Name, selector.Key))
+	}
+
+	return string(value), nil
+}
+
+// secretNamespace returns the namespace of a Secret a provider in namespace selects. Empty
+// namespace stands for a ClusterDNSProvider.
+func (w *recordWriter) secretNamespace(namespace string, selector dnsv1.SecretKeySelector) string {
+
+	switch {
+	case namespace != "":
+		return namespace
+	case selector.Namespace != "":
+		return selector.Namespace
+	default:
+		return w.ConfigMapNamespace
+	}
+}
+
+// providerSecrets returns the Secrets a DNSProvider spec reads.
+func providerSecrets(spec dnsv1.DNSProviderSpec) []dnsv1.SecretKeySelector {
+
+	var selectors []dnsv1.SecretKeySelector
+	if spec.Cloudflare != nil {
+		selectors = append(selectors, spec.Cloudflare.APITokenSecretRef)
+	}
+	if spec.RFC2136 != nil {
+		selectors = append(selectors, spec.RFC2136.TSIGSecretRef)
+	}
+
+	return selectors
+}
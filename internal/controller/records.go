@@ -0,0 +1,411 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+// ProviderFactory creates the DNS provider for a type and its configuration. Reconcilers
+// without one use dnsapi.NewProvider.
+type ProviderFactory func(ptype string, config map[string]string) (dnsapi.Provider, error)
+
+// recordWriter writes and removes the DNS records of an object. It holds what the
+// reconcilers share: the operator configuration, the DNS providers and the Event recorder.
+type recordWriter struct {
+	client.Client
+	ConfigMapName      string
+	ConfigMapNamespace string
+	Recorder           events.EventRecorder
+	NewProvider        ProviderFactory
+
+	// Scope restricts the Ingresses that may publish hostnames.
+	Scope IngressScope
+
+	// cfg is the operator configuration, set by loadOperatorConfig
+	cfg operatorConfig
+}
+
+// ownerValue returns the content of the ownership TXT records the writer writes.
+func (w *recordWriter) ownerValue() string {
+	return w.cfg.ownerValue()
+}
+
+// provider creates the DNS provider a reference selects for an object in namespace.
+// Overrides replace settings of the provider configuration for this provider only.
+func (w *recordWriter) provider(ctx context.Context, namespace string, ref dnsv1.ProviderReference, overrides map[string]string) (*resolvedProvider, error) {
+
+	ref, err := w.normalizeRef(namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	ptype, dnsconfig, zones, err := w.providerConfig(ctx, namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range overrides {
+		dnsconfig[key] = value
+	}
+
+	provider, err := w.newProvider(ptype, dnsconfig)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("invalid configuration in %s: %w", refName(ref), err))
+	}
+
+	policy, err := w.namespacePolicy(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	wildcards, ok := provider.(dnsapi.WildcardProvider)
+
+	return &resolvedProvider{
+		Provider:  &instrumentedProvider{Provider: provider, name: ptype},
+		ptype:     ptype,
+		ref:       ref,
+		zones:     zones,
+		policy:    policy,
+		wildcards: ok && wildcards.SupportsWildcards(),
+	}, nil
+}
+
+// normalizeRef returns a provider reference in the form it is recorded in. Sources are
+// recorded as namespace/name, which finds them again regardless of the namespace of the
+// object and of namespaceLocalSources.
+func (w *recordWriter) normalizeRef(namespace string, ref dnsv1.ProviderReference) (dnsv1.ProviderReference, error) {
+
+	if ref.Kind != "" {
+		return dnsv1.ProviderReference{Kind: ref.Kind, Name: ref.Name}, nil
+	}
+
+	key, err := w.sourceKey(namespace, ref.Source)
+	if err != nil {
+		return dnsv1.ProviderReference{}, err
+	}
+
+	return dnsv1.ProviderReference{Type: ref.Type, Source: key.String()}, nil
+}
+
+// newProvider creates a DNS provider with NewProvider, or dnsapi.NewProvider if it is not set.
+func (w *recordWriter) newProvider(ptype string, config map[string]string) (dnsapi.Provider, error) {
+
+	if w.NewProvider != nil {
+		return w.NewProvider(ptype, config)
+	}
+
+	return dnsapi.NewProvider(ptype, config)
+}
+
+// removeRecord deletes a managed record of obj with the provider it was written with.
+func (w *recordWriter) removeRecord(ctx context.Context, obj client.Object, record dnsv1.ManagedRecord) error {
+
+	provider, err := w.provider(ctx, obj.GetNamespace(), w.recordProvider(record), nil)
+	if err != nil {
+		return err
+	}
+
+	return w.deleteRecords(ctx, obj, provider, record.Host, record.Type)
+}
+
+// ownerRecord returns the TXT record with the given owner value that marks a domain as managed
+// by kube-dns-manager, or an orphaned one, or nil if the domain has neither.
+func ownerRecord(provider dnsapi.Provider, domain string, owner string) (*dnsapi.Record, error) {
+
+	records, err := provider.GetRecords(domain, "TXT")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		records[i].Content = strings.Trim(records[i].Content, `"`)
+		if records[i].Content == owner || records[i].Content == orphanedTXTValue {
+			return &records[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// recordTypeFor returns the record type for a target address.
+func recordTypeFor(target string) (string, error) {
+
+	ip := net.ParseIP(target)
+	switch {
+	case ip == nil:
+		return "", permanent(fmt.Errorf("target %s is not an IP address", target))
+	case ip.To4() != nil:
+		return "A", nil
+	default:
+		return "AAAA", nil
+	}
+}
+
+// ensureRecords makes the records of a domain point to the targets, creates the ownership TXT
+// record and returns their IDs and whether anything had to be written. Records that exist
+// without an ownership TXT record belong to someone else and are left alone; orphaned records
+// are adopted.
+func (w *recordWriter) ensureRecords(ctx context.Context, obj runtime.Object, provider dnsapi.Provider, domain string, recordType string, targets []string) ([]string, bool, error) {
+
+	owner, err := ownerRecord(provider, domain, w.ownerValue())
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := provider.GetRecords(domain, recordType)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if owner == nil && len(existing) > 0 {
+		return nil, false, errRecordNotOwned
+	}
+
+	// Keep the records that point to a target, the others are reused for the missing targets
+	var kept, surplus []dnsapi.Record
+	for _, record := range existing {
+		if containsString(targets, record.Content) && !containsString(recordContents(kept), record.Content) {
+			kept = append(kept, record)
+		} else {
+			surplus = append(surplus, record)
+		}
+	}
+
+	changed := owner == nil || owner.Content != w.ownerValue()
+	for _, target := range targets {
+		if containsString(recordContents(kept), target) {
+			continue
+		}
+		changed = true
+
+		if len(surplus) > 0 {
+			record := surplus[0]
+			surplus = surplus[1:]
+			if err := provider.UpdateRecord(record, target); err != nil {
+				return nil, false, err
+			}
+			w.recordEvent(obj, corev1.EventTypeNormal, reasonRecordUpdated, "Updated %s record %s from %s to %s", recordType, domain, record.Content, target)
+			record.Content = target
+			kept = append(kept, record)
+			continue
+		}
+
+		record, err := provider.AddRecord(domain, recordType, target)
+		if err != nil {
+			return nil, false, err
+		}
+		w.recordEvent(obj, corev1.EventTypeNormal, reasonRecordCreated, "Created %s record %s pointing to %s", recordType, domain, target)
+		kept = append(kept, record)
+	}
+
+	for _, record := range surplus {
+		if err := provider.DeleteRecord(record); err != nil {
+			return nil, false, err
+		}
+		changed = true
+		w.recordEvent(obj, corev1.EventTypeNormal, reasonRecordDeleted, "Deleted %s record %s pointing to %s", recordType, domain, record.Content)
+	}
+
+	if owner == nil {
+		txt, err := provider.AddRecord(domain, "TXT", w.ownerValue())
+		if err != nil {
+			return nil, false, err
+		}
+		owner = &txt
+	} else if owner.Content != w.ownerValue() {
+		if err := provider.UpdateRecord(*owner, w.ownerValue()); err != nil {
+			return nil, false, err
+		}
+		w.recordEvent(obj, corev1.EventTypeNormal, reasonRecordAdopted, "Adopted orphaned %s record %s", recordType, domain)
+	}
+
+	return recordIDs(append(kept, *owner)...), changed, nil
+}
+
+// recordContents returns the contents of records.
+func recordContents(records []dnsapi.Record) []string {
+
+	var contents []string
+	for _, record := range records {
+		contents = append(contents, record.Content)
+	}
+
+	return contents
+}
+
+// recordIDs returns the non-empty provider IDs of records.
+func recordIDs(records ...dnsapi.Record) []string {
+
+	var ids []string
+	for _, record := range records {
+		if record.ID != "" {
+			ids = append(ids, record.ID)
+		}
+	}
+
+	return ids
+}
+
+// deleteRecords removes the records of a type of a domain and its TXT record if kube-dns-manager
+// owns them.
+func (w *recordWriter) deleteRecords(ctx context.Context, obj runtime.Object, provider dnsapi.Provider, domain string, recordType string) error {
+	logger := log.FromContext(ctx)
+
+	owner, err := ownerRecord(provider, domain, w.ownerValue())
+	if err != nil {
+		return err
+	}
+	if owner == nil || owner.Content != w.ownerValue() {
+		logger.Info("DNS records are not owned by kube-dns-manager. Skipping deletion...", "domain", domain)
+		w.recordEvent(obj, corev1.EventTypeNormal, reasonRecordNotOwned, "Left %s record %s in place, it is not owned by kube-dns-manager", recordType, domain)
+		return nil
+	}
+
+	records, err := provider.GetRecords(domain, recordType)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := provider.DeleteRecord(record); err != nil {
+			return err
+		}
+	}
+
+	// The ownership TXT record stays while the other record of a dual-stack host is left
+	others, err := hasOtherAddressRecords(provider, domain, recordType)
+	if err != nil {
+		return err
+	}
+	if !others {
+		if err := provider.DeleteRecord(*owner); err != nil {
+			return err
+		}
+	}
+
+	w.recordEvent(obj, corev1.EventTypeNormal, reasonRecordDeleted, "Deleted %s record %s", recordType, domain)
+	return nil
+}
+
+// hasOtherAddressRecords reports whether a domain has address records of another type than recordType.
+func hasOtherAddressRecords(provider dnsapi.Provider, domain string, recordType string) (bool, error) {
+
+	for _, otherType := range []string{"A", "AAAA"} {
+		if otherType == recordType {
+			continue
+		}
+		records, err := provider.GetRecords(domain, otherType)
+		if err != nil {
+			return false, err
+		}
+		if len(records) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// releaseRecords marks the ownership TXT record of a domain as orphaned and keeps the A record.
+func (w *recordWriter) releaseRecords(ctx context.Context, obj runtime.Object, provider dnsapi.Provider, domain string) error {
+
+	owner, err := ownerRecord(provider, domain, w.ownerValue())
+	if err != nil {
+		return err
+	}
+	if owner == nil || owner.Content != w.ownerValue() {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Retaining DNS records", "domain", domain)
+	if err := provider.UpdateRecord(*owner, orphanedTXTValue); err != nil {
+		return err
+	}
+
+	w.recordEvent(obj, corev1.EventTypeNormal, reasonRecordRetained, "Retained records of %s, marked them as orphaned", domain)
+	return nil
+}
+
+// sourceKey returns where the dns.configuration/source of an object in namespace is read
+// from. Names are looked up in the operator namespace, or with namespaceLocalSources in the
+// namespace of the object. namespace/name selects a source in the operator namespace, a
+// shared namespace or, with namespaceLocalSources, the namespace of the object.
+func (w *recordWriter) sourceKey(namespace string, source string) (client.ObjectKey, error) {
+
+	sourceNamespace, name, qualified := strings.Cut(source, "/")
+	if !qualified {
+		if w.cfg.NamespaceLocalSources && namespace != "" {
+			return client.ObjectKey{Namespace: namespace, Name: source}, nil
+		}
+		return client.ObjectKey{Namespace: w.ConfigMapNamespace, Name: source}, nil
+	}
+
+	switch {
+	case sourceNamespace == w.ConfigMapNamespace, containsString(w.cfg.SharedSourceNamespaces, sourceNamespace):
+	case w.cfg.NamespaceLocalSources && sourceNamespace == namespace:
+	default:
+		return client.ObjectKey{}, permanent(fmt.Errorf("configuration source %s: namespace %s is not shared", source, sourceNamespace))
+	}
+
+	return client.ObjectKey{Namespace: sourceNamespace, Name: name}, nil
+}
+
+// qualifySource returns a source as namespace/name, a bare name is taken to be in namespace.
+func qualifySource(source string, namespace string) string {
+
+	if source == "" || strings.Contains(source, "/") {
+		return source
+	}
+
+	return namespace + "/" + source
+}
+
+// Load DNS configuration from ConfigMap or Secret
+func (w *recordWriter) loadDNSConfiguration(ctx context.Context, key client.ObjectKey) (map[string]string, error) {
+	config := make(map[string]string)
+
+	// Try to load as ConfigMap
+	var configMap corev1.ConfigMap
+	if err := w.Get(ctx, key, &configMap); err == nil {
+		for key, value := range configMap.Data {
+			config[key] = value
+		}
+		return config, nil
+	}
+
+	// Try to load as Secret
+	var secret corev1.Secret
+	if err := w.Get(ctx, key, &secret); err == nil {
+		for key, value := range secret.Data {
+			config[key] = string(value)
+		}
+		return config, nil
+	}
+
+	return nil, fmt.Errorf("configuration source %s not found as ConfigMap or Secret in namespace %s", key.Name, key.Namespace)
+}
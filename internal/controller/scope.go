@@ -0,0 +1,114 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ingressClassAnnotation is the class annotation of Ingresses older than spec.ingressClassName.
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+// IngressScope restricts the Ingresses the operator manages. The zero value manages all of them.
+type IngressScope struct {
+	// IngressClasses are the classes of managed Ingresses, read from spec.ingressClassName or
+	// the kubernetes.io/ingress.class annotation. Ingresses without a class are not managed
+	// when set.
+	IngressClasses []string
+	// Namespaces are the namespaces of managed Ingresses.
+	Namespaces []string
+	// Selector selects managed Ingresses by their labels.
+	Selector labels.Selector
+}
+
+// ParseIngressScope builds a scope from comma-separated classes and namespaces and a label
+// selector. Empty values do not restrict anything.
+func ParseIngressScope(classes, namespaces, selector string) (IngressScope, error) {
+
+	scope := IngressScope{
+		IngressClasses: splitList(classes),
+		Namespaces:     splitList(namespaces),
+	}
+
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return IngressScope{}, fmt.Errorf("invalid Ingress label selector %q: %w", selector, err)
+		}
+		scope.Selector = parsed
+	}
+
+	return scope, nil
+}
+
+// Matches reports whether the operator manages an Ingress.
+func (s IngressScope) Matches(ingress *networkingv1.Ingress) bool {
+
+	if len(s.Namespaces) > 0 && !containsString(s.Namespaces, ingress.Namespace) {
+		return false
+	}
+	if s.Selector != nil && !s.Selector.Matches(labels.Set(ingress.Labels)) {
+		return false
+	}
+	if len(s.IngressClasses) > 0 && !containsString(s.IngressClasses, ingressClass(ingress)) {
+		return false
+	}
+
+	return true
+}
+
+// predicate passes the events of managed Ingresses, and of Ingresses that still carry the
+// finalizer from when they were managed, so their records are cleaned up.
+func (s IngressScope) predicate() predicate.Predicate {
+
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		ingress, ok := obj.(*networkingv1.Ingress)
+		if !ok {
+			return false
+		}
+		return s.Matches(ingress) || containsString(ingress.Finalizers, cleanupFinalizer)
+	})
+}
+
+// ingressClass returns the class of an Ingress, "" if it has none.
+func ingressClass(ingress *networkingv1.Ingress) string {
+
+	if ingress.Spec.IngressClassName != nil {
+		return *ingress.Spec.IngressClassName
+	}
+
+	return ingress.Annotations[ingressClassAnnotation]
+}
+
+// splitList splits a comma-separated list and drops empty entries.
+func splitList(value string) []string {
+
+	var result []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("Ingress scope", func() {
+	const namespace = "shop"
+
+	ctx := context.Background()
+
+	var (
+		provider   *fakeProvider
+		reconciler *IngressReconciler
+		ingress    *k8snetworkingv1.Ingress
+		objects    []client.Object
+		scope      IngressScope
+	)
+
+	reconcileIngress := func(ingress *k8snetworkingv1.Ingress) {
+		if reconciler == nil {
+			reconciler = newTestReconciler("kube-system", provider, objects...)
+			reconciler.Scope = scope
+		}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		provider = &fakeProvider{}
+		reconciler = nil
+		className := "traefik"
+		ingress = &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: namespace,
+				Labels:    map[string]string{"dns": "public"},
+				Annotations: map[string]string{
+					typeAnnotationKey:   dnsapi.ProviderCloudflare,
+					sourceAnnotationKey: "cloudflare-config",
+				},
+			},
+			Spec: k8snetworkingv1.IngressSpec{
+				IngressClassName: &className,
+				Rules:            []k8snetworkingv1.IngressRule{{Host: "shop.example.com"}},
+			},
+		}
+		var err error
+		scope, err = ParseIngressScope("traefik, traefik-internal", "", "dns=public")
+		Expect(err).NotTo(HaveOccurred())
+		objects = []client.Object{
+			ingress,
+			loadBalancer("traefik", "192.0.2.10"),
+			cloudflareSource("cloudflare-config", "kube-system"),
+		}
+	})
+
+	It("should match Ingresses by class, namespace and labels", func() {
+		Expect(scope.Matches(ingress)).To(BeTrue())
+
+		other := ingress.DeepCopy()
+		other.Spec.IngressClassName = nil
+		Expect(scope.Matches(other)).To(BeFalse())
+		other.Annotations[ingressClassAnnotation] = "traefik-internal"
+		Expect(scope.Matches(other)).To(BeTrue())
+
+		other.Labels = nil
+		Expect(scope.Matches(other)).To(BeFalse())
+
+		scope.Namespaces = []string{"blog"}
+		Expect(scope.Matches(ingress)).To(BeFalse())
+
+		Expect(IngressScope{}.Matches(other)).To(BeTrue())
+
+		_, err := ParseIngressScope("", "", "dns in (")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should only pass events of managed Ingresses", func() {
+		other := ingress.DeepCopy()
+		other.Labels = nil
+		Expect(scope.predicate().Create(event.CreateEvent{Object: ingress})).To(BeTrue())
+		Expect(scope.predicate().Create(event.CreateEvent{Object: other})).To(BeFalse())
+
+		other.Finalizers = []string{cleanupFinalizer}
+		Expect(scope.predicate().Delete(event.DeleteEvent{Object: other})).To(BeTrue())
+	})
+
+	It("should publish managed Ingresses", func() {
+		reconcileIngress(ingress)
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(ingress.Finalizers).To(ContainElement(cleanupFinalizer))
+	})
+
+	It("should not touch Ingresses outside the scope", func() {
+		ingress.Labels = nil
+		reconcileIngress(ingress)
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(ingress.Finalizers).To(BeEmpty())
+	})
+
+	It("should not add the finalizer to Ingresses without DNS annotations", func() {
+		ingress.Annotations = nil
+		reconcileIngress(ingress)
+
+		Expect(provider.records).To(BeEmpty())
+		Expect(ingress.Finalizers).To(BeEmpty())
+	})
+
+	It("should remove the finalizer from unmanaged Ingresses without records", func() {
+		ingress.Annotations = nil
+		ingress.Finalizers = []string{cleanupFinalizer}
+		reconcileIngress(ingress)
+
+		Expect(ingress.Finalizers).To(BeEmpty())
+	})
+
+	It("should clean up records of Ingresses that left the scope", func() {
+		reconcileIngress(ingress)
+
+		ingress.Labels = nil
+		Expect(reconciler.Update(ctx, ingress)).To(Succeed())
+		reconcileIngress(ingress)
+
+		Expect(ingress.Finalizers).To(ContainElement(cleanupFinalizer))
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+
+		Expect(reconciler.Delete(ctx, ingress)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.records).To(BeEmpty())
+	})
+
+	It("should not let Ingresses outside the scope own a hostname", func() {
+		outside := ingress.DeepCopy()
+		outside.Namespace = "blog"
+		outside.Labels = nil
+		outside.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+		objects = append(objects, outside)
+		reconcileIngress(ingress)
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+
+		var recordSet networkingv1.DNSRecordSet
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: "ingress-web", Namespace: namespace}, &recordSet)).To(Succeed())
+		Expect(recordSet.Status.Conflicts).To(BeEmpty())
+	})
+
+	It("should only report an invalid targets annotation as error", func() {
+		cfg := operatorConfig{scope: scope}
+		ingress.Annotations = map[string]string{targetsAnnotationKey: "- type: cloudflare\n  source: cloudflare-config\n"}
+
+		ingress.Labels = nil
+		_, found, err := cfg.ingressProviderRef(ingress)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+
+		ingress.Annotations[targetsAnnotationKey] = "- type: cloudflare\n"
+		_, _, err = cfg.ingressProviderRef(ingress)
+		Expect(err).NotTo(HaveOccurred())
+
+		ingress.Labels = map[string]string{"dns": "public"}
+		_, found, err = cfg.ingressProviderRef(ingress)
+		Expect(err).To(MatchError(ContainSubstring("must select one provider")))
+		Expect(found).To(BeFalse())
+	})
+
+	It("should not validate Ingresses outside the scope", func() {
+		ingress.Labels = nil
+		ingress.Annotations[typeAnnotationKey] = "cloudflair"
+		validator := &IngressValidator{
+			Client:             newFakeClient(objects...),
+			ConfigMapName:      "dns-operator-config",
+			ConfigMapNamespace: "kube-system",
+			Scope:              scope,
+		}
+		_, err := validator.ValidateIngress(ctx, ingress)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
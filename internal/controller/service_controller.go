@@ -0,0 +1,237 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// hostnameAnnotationKey lists the hostnames of a Service, separated by commas.
+const hostnameAnnotationKey = "dns.configuration/hostname"
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=update;patch
+// +kubebuilder:rbac:groups="",resources=services/finalizers,verbs=update
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+
+// ServiceReconciler publishes the hostnames of Services annotated with
+// dns.configuration/hostname. For Services of type LoadBalancer the records point to the
+// addresses of the Service itself. For headless Services they point to the ready endpoints,
+// and every endpoint with a hostname, e.g. a StatefulSet pod, gets a record of its own below
+// the hostname of the Service. Services with provider annotations but without
+// dns.configuration/hostname get their hostnames from the hostnameTemplates.
+type ServiceReconciler struct {
+	client.Client
+	Scheme             *runtime.Scheme
+	ConfigMapName      string
+	ConfigMapNamespace string
+	Recorder           events.EventRecorder
+
+	NewProvider ProviderFactory
+
+	// Scope is the scope of the IngressReconciler. Ingresses outside it own no hostnames.
+	Scope IngressScope
+}
+
+// serviceSource is the hostSource of Services of type LoadBalancer and headless Services.
+type serviceSource struct{}
+
+var serviceHostSource = &serviceSource{}
+
+func (s *serviceSource) kind() string               { return "Service" }
+func (s *serviceSource) newObject() client.Object   { return &corev1.Service{} }
+func (s *serviceSource) newList() client.ObjectList { return &corev1.ServiceList{} }
+
+// manages reports whether a Service is of type LoadBalancer or headless and declares
+// hostnames or, for generated hostnames, selects a provider.
+func (s *serviceSource) manages(obj client.Object) bool {
+
+	service, ok := obj.(*corev1.Service)
+	if !ok || service.Spec.Type != corev1.ServiceTypeLoadBalancer && !isHeadless(service) {
+		return false
+	}
+	_, found := service.Annotations[hostnameAnnotationKey]
+
+	return found || hasProviderAnnotation(service.Annotations)
+}
+
+// templated makes Services without dns.configuration/hostname use the hostnameTemplates.
+func (s *serviceSource) templated() {}
+
+// isHeadless reports whether a Service has no cluster IP.
+func isHeadless(service *corev1.Service) bool {
+	return service.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+// hosts returns the hostnames of the dns.configuration/hostname annotation.
+func (s *serviceSource) hosts(obj client.Object) []string {
+
+	return normalizeHosts(splitList(obj.GetAnnotations()[hostnameAnnotationKey]))
+}
+
+// targets returns the IP addresses the load balancer of the Service got. IPv4 addresses are
+// published as A records; AAAA records are only published if there are none.
+func (s *serviceSource) targets(ctx context.Context, c client.Reader, obj client.Object, cfg operatorConfig) (string, []string, error) {
+
+	service := obj.(*corev1.Service)
+
+	var addresses []string
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" && !containsString(addresses, ingress.IP) {
+			addresses = append(addresses, ingress.IP)
+		}
+	}
+	if len(addresses) == 0 {
+		return "", nil, fmt.Errorf("no LoadBalancer IP found for service %s/%s", service.Namespace, service.Name)
+	}
+
+	return addressTargets(addresses)
+}
+
+// records returns the records of the hostnames a Service owns. The ones of headless Services
+// are built from their EndpointSlices.
+func (s *serviceSource) records(ctx context.Context, c client.Reader, obj client.Object, hosts []string, cfg operatorConfig) ([]desiredRecord, error) {
+
+	service := obj.(*corev1.Service)
+	if !isHeadless(service) {
+		recordType, targets, err := s.targets(ctx, c, obj, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return desiredRecords(hosts, recordType, targets), nil
+	}
+
+	var slices discoveryv1.EndpointSliceList
+	if err := c.List(ctx, &slices, client.InNamespace(service.Namespace), client.MatchingLabels{discoveryv1.LabelServiceName: service.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list EndpointSlices of service %s/%s: %w", service.Namespace, service.Name, err)
+	}
+
+	// Addresses of all ready endpoints, and of the ones with a hostname
+	var addresses []string
+	var endpointNames []string
+	endpointAddresses := map[string][]string{}
+	for _, slice := range slices.Items {
+		if slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				if !containsString(addresses, address) {
+					addresses = append(addresses, address)
+				}
+				if endpoint.Hostname == nil || *endpoint.Hostname == "" {
+					continue
+				}
+				if _, found := endpointAddresses[*endpoint.Hostname]; !found {
+					endpointNames = append(endpointNames, *endpoint.Hostname)
+				}
+				endpointAddresses[*endpoint.Hostname] = append(endpointAddresses[*endpoint.Hostname], address)
+			}
+		}
+	}
+	sort.Strings(endpointNames)
+
+	// Without ready endpoints there is nothing to publish; records published before are removed
+	var desired []desiredRecord
+	for _, host := range hosts {
+		desired = append(desired, addressRecords(host, addresses)...)
+		for _, name := range endpointNames {
+			endpointHost := name + "." + host
+			if cfg.excludes(endpointHost) {
+				continue
+			}
+			desired = append(desired, addressRecords(endpointHost, endpointAddresses[name])...)
+		}
+	}
+
+	return desired, nil
+}
+
+// addressRecords returns the records of a host for the IP addresses of endpoints: an A record
+// for the IPv4 and an AAAA record for the IPv6 addresses, so dual-stack pods resolve with both.
+func addressRecords(host string, addresses []string) []desiredRecord {
+
+	var ipv4, ipv6 []string
+	for _, address := range addresses {
+		recordType, err := recordTypeFor(address)
+		switch {
+		case err != nil:
+			continue
+		case recordType == "A":
+			ipv4 = append(ipv4, address)
+		default:
+			ipv6 = append(ipv6, address)
+		}
+	}
+
+	var desired []desiredRecord
+	if len(ipv4) > 0 {
+		desired = append(desired, desiredRecord{host: host, recordType: "A", targets: ipv4})
+	}
+	if len(ipv6) > 0 {
+		desired = append(desired, desiredRecord{host: host, recordType: "AAAA", targets: ipv6})
+	}
+
+	return desired
+}
+
+// servicesForEndpointSlice maps an EndpointSlice to its Service.
+func servicesForEndpointSlice(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	name := obj.GetLabels()[discoveryv1.LabelServiceName]
+	if name == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	reconciler := &sourceReconciler{
+		Client:             r.Client,
+		Scheme:             r.Scheme,
+		ConfigMapName:      r.ConfigMapName,
+		ConfigMapNamespace: r.ConfigMapNamespace,
+		Recorder:           r.Recorder,
+		NewProvider:        r.NewProvider,
+		Scope:              r.Scope,
+		source:             serviceHostSource,
+	}
+	b, err := reconciler.builder(mgr)
+	if err != nil {
+		return err
+	}
+
+	// Headless Services follow their ready endpoints
+	return b.Watches(&discoveryv1.EndpointSlice{}, handler.EnqueueRequestsFromMapFunc(servicesForEndpointSlice)).
+		Complete(reconciler)
+}
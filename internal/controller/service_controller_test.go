@@ -0,0 +1,273 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("LoadBalancer Services", func() {
+	const namespace = "iot"
+
+	ctx := context.Background()
+
+	var (
+		provider   *fakeProvider
+		reconciler *sourceReconciler
+		service    *corev1.Service
+		objects    []client.Object
+	)
+
+	reconcileService := func() {
+		if reconciler == nil {
+			reconciler = newTestSourceReconciler(serviceHostSource, "kube-system", provider, append(objects, service)...)
+		}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(service)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		provider = &fakeProvider{}
+		reconciler = nil
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mqtt",
+				Namespace: namespace,
+				Annotations: map[string]string{
+					typeAnnotationKey:     dnsapi.ProviderCloudflare,
+					sourceAnnotationKey:   "cloudflare-config",
+					hostnameAnnotationKey: "mqtt.example.com, broker.example.com",
+				},
+			},
+			Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{
+					{IP: "192.0.2.30"},
+					{IP: "192.0.2.31"},
+					{IP: "2001:db8::30"},
+				}},
+			},
+		}
+		objects = []client.Object{
+			cloudflareSource("cloudflare-config", "kube-system"),
+		}
+	})
+
+	It("should publish the hostnames with the addresses of the Service", func() {
+		reconcileService()
+
+		Expect(provider.content("mqtt.example.com", "A")).To(ConsistOf("192.0.2.30", "192.0.2.31"))
+		Expect(provider.content("broker.example.com", "A")).To(ConsistOf("192.0.2.30", "192.0.2.31"))
+		Expect(service.Finalizers).To(ContainElement(cleanupFinalizer))
+
+		var recordSet networkingv1.DNSRecordSet
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: "service-mqtt", Namespace: namespace}, &recordSet)).To(Succeed())
+		Expect(recordSet.Status.Records).To(HaveLen(2))
+	})
+
+	It("should follow the addresses of the load balancer", func() {
+		reconcileService()
+
+		service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "192.0.2.32"}}
+		Expect(reconciler.Status().Update(ctx, service)).To(Succeed())
+		reconcileService()
+
+		Expect(provider.content("mqtt.example.com", "A")).To(ConsistOf("192.0.2.32"))
+	})
+
+	It("should report Services without a load balancer address as failed", func() {
+		service.Status.LoadBalancer.Ingress = nil
+		reconcileService()
+
+		Expect(provider.records).To(BeEmpty())
+		var recordSet networkingv1.DNSRecordSet
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: "service-mqtt", Namespace: namespace}, &recordSet)).To(Succeed())
+		Expect(recordSet.Status.Failures).To(HaveLen(2))
+	})
+
+	It("should not manage other Services", func() {
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		reconcileService()
+		Expect(service.Finalizers).To(BeEmpty())
+
+		delete(service.Annotations, hostnameAnnotationKey)
+		service.Spec.Type = corev1.ServiceTypeLoadBalancer
+		Expect(reconciler.Update(ctx, service)).To(Succeed())
+		reconcileService()
+		Expect(service.Finalizers).To(BeEmpty())
+
+		Expect(provider.records).To(BeEmpty())
+	})
+
+	It("should remove the records when the Service is deleted", func() {
+		reconcileService()
+		Expect(reconciler.Delete(ctx, service)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(service)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.records).To(BeEmpty())
+	})
+
+	Context("headless", func() {
+		newSlice := func(name string, addressType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+			return &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels:    map[string]string{discoveryv1.LabelServiceName: "kafka"},
+				},
+				AddressType: addressType,
+				Endpoints:   endpoints,
+			}
+		}
+		endpoint := func(hostname string, ready bool, addresses ...string) discoveryv1.Endpoint {
+			return discoveryv1.Endpoint{Hostname: &hostname, Addresses: addresses, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}
+		}
+
+		BeforeEach(func() {
+			service = &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "kafka",
+					Namespace: namespace,
+					Annotations: map[string]string{
+						typeAnnotationKey:     dnsapi.ProviderCloudflare,
+						sourceAnnotationKey:   "cloudflare-config",
+						hostnameAnnotationKey: "kafka.internal.example.com",
+					},
+				},
+				Spec: corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone},
+			}
+			objects = append(objects,
+				newSlice("kafka-ipv4", discoveryv1.AddressTypeIPv4,
+					endpoint("kafka-0", true, "10.0.0.10"),
+					endpoint("kafka-1", true, "10.0.0.11"),
+					endpoint("kafka-2", false, "10.0.0.12"),
+				),
+				newSlice("kafka-ipv6", discoveryv1.AddressTypeIPv6,
+					endpoint("kafka-0", true, "fd00::10"),
+					endpoint("kafka-3", true, "fd00::13"),
+				),
+				&discoveryv1.EndpointSlice{
+					ObjectMeta:  metav1.ObjectMeta{Name: "other", Namespace: namespace, Labels: map[string]string{discoveryv1.LabelServiceName: "zookeeper"}},
+					AddressType: discoveryv1.AddressTypeIPv4,
+					Endpoints:   []discoveryv1.Endpoint{endpoint("zookeeper-0", true, "10.0.0.20")},
+				},
+			)
+		})
+
+		It("should publish a record for every ready endpoint with a hostname", func() {
+			reconcileService()
+
+			Expect(provider.content("kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.10", "10.0.0.11"))
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.10"))
+			Expect(provider.content("kafka-1.kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.11"))
+			Expect(provider.content("kafka-2.kafka.internal.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("kafka-3.kafka.internal.example.com", "AAAA")).To(ConsistOf("fd00::13"))
+			Expect(provider.content("zookeeper-0.kafka.internal.example.com", "A")).To(BeEmpty())
+			Expect(service.Finalizers).To(ContainElement(cleanupFinalizer))
+		})
+
+		It("should remove the records of endpoints that are no longer ready", func() {
+			reconcileService()
+
+			var slice discoveryv1.EndpointSlice
+			Expect(reconciler.Get(ctx, client.ObjectKey{Name: "kafka-ipv4", Namespace: namespace}, &slice)).To(Succeed())
+			notReady := false
+			slice.Endpoints[1].Conditions.Ready = &notReady
+			Expect(reconciler.Update(ctx, &slice)).To(Succeed())
+			reconcileService()
+
+			Expect(provider.content("kafka-1.kafka.internal.example.com", "A")).To(BeEmpty())
+			Expect(provider.content("kafka-1.kafka.internal.example.com", "TXT")).To(BeEmpty())
+			Expect(provider.content("kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.10"))
+		})
+
+		It("should publish A and AAAA records for dual-stack endpoints", func() {
+			reconcileService()
+
+			Expect(provider.content("kafka.internal.example.com", "AAAA")).To(ConsistOf("fd00::10", "fd00::13"))
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.10"))
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "AAAA")).To(ConsistOf("fd00::10"))
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "TXT")).To(HaveLen(1))
+
+			var recordSet networkingv1.DNSRecordSet
+			Expect(reconciler.Get(ctx, client.ObjectKey{Name: "service-kafka", Namespace: namespace}, &recordSet)).To(Succeed())
+			Expect(recordSet.Status.Records).To(HaveLen(6))
+			Expect(recordSet.Status.Hosts).To(ContainElement(HaveField("Target", "10.0.0.10,fd00::10")))
+
+			// Without IPv6 endpoints only the AAAA records are removed
+			var slice discoveryv1.EndpointSlice
+			Expect(reconciler.Get(ctx, client.ObjectKey{Name: "kafka-ipv6", Namespace: namespace}, &slice)).To(Succeed())
+			Expect(reconciler.Delete(ctx, &slice)).To(Succeed())
+			reconcileService()
+
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "AAAA")).To(BeEmpty())
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.10"))
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "TXT")).To(HaveLen(1))
+			Expect(provider.content("kafka-3.kafka.internal.example.com", "TXT")).To(BeEmpty())
+			Expect(provider.content("kafka.internal.example.com", "AAAA")).To(BeEmpty())
+
+			Expect(reconciler.Delete(ctx, service)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(service)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(provider.records).To(BeEmpty())
+		})
+
+		It("should leave the hostnames of endpoints to their owner", func() {
+			reconcileService()
+			Expect(provider.content("kafka-1.kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.11"))
+
+			Expect(reconciler.Create(ctx, &k8snetworkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "kafka-1", Namespace: "other", Annotations: map[string]string{
+					typeAnnotationKey:   dnsapi.ProviderCloudflare,
+					sourceAnnotationKey: "cloudflare-config",
+				}},
+				Spec: k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "kafka-1.kafka.internal.example.com"}}},
+			})).To(Succeed())
+			reconcileService()
+
+			// The records are taken over by the Ingress
+			Expect(provider.content("kafka-1.kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.11"))
+			Expect(provider.content("kafka-0.kafka.internal.example.com", "A")).To(ConsistOf("10.0.0.10"))
+			var recordSet networkingv1.DNSRecordSet
+			Expect(reconciler.Get(ctx, client.ObjectKey{Name: "service-kafka", Namespace: namespace}, &recordSet)).To(Succeed())
+			Expect(recordSet.Status.Conflicts).To(ConsistOf(networkingv1.HostConflict{Host: "kafka-1.kafka.internal.example.com", Owner: "other/kafka-1"}))
+			Expect(recordSet.Status.Records).NotTo(ContainElement(HaveField("Host", "kafka-1.kafka.internal.example.com")))
+		})
+
+		It("should map EndpointSlices to their Service", func() {
+			slice := newSlice("kafka-abc", discoveryv1.AddressTypeIPv4)
+			Expect(servicesForEndpointSlice(ctx, slice)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(service)}))
+
+			slice.Labels = nil
+			Expect(servicesForEndpointSlice(ctx, slice)).To(BeEmpty())
+		})
+	})
+})
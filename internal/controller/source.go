@@ -0,0 +1,579 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// sourceHostIndexKey indexes the objects of every hostSource by the hostnames they declare.
+const sourceHostIndexKey = "dns.hostnames"
+
+// hostSource is a kind of object whose hostnames are published like the ones of an Ingress:
+// the DNS annotations select the provider, the records are tracked in a DNSRecordSet and a
+// finalizer removes them when the object is deleted.
+type hostSource interface {
+	// kind is the kind of the objects, e.g. HTTPRoute.
+	kind() string
+	newObject() client.Object
+	newList() client.ObjectList
+	// hosts returns the hostnames an object declares.
+	hosts(obj client.Object) []string
+	// targets returns the record type and the addresses the records of an object point to.
+	targets(ctx context.Context, c client.Reader, obj client.Object, cfg operatorConfig) (string, []string, error)
+}
+
+// hostSources are the kinds besides Ingress whose hostnames are published. Ingresses own a
+// hostname before any of them.
+var hostSources = []hostSource{httpRouteSource, grpcRouteSource, tlsRouteSource, ingressRouteSource, serviceHostSource}
+
+// indexSourceHosts returns the index function of a hostSource.
+func indexSourceHosts(source hostSource) client.IndexerFunc {
+	return func(obj client.Object) []string {
+		return source.hosts(obj)
+	}
+}
+
+// sourceOwner returns the object that may publish a hostname: the Ingress hostOwner returns,
+// or else the first of the hostSource objects that declare it and select a provider. Kinds
+// whose resources are not installed are skipped.
+func sourceOwner(ctx context.Context, c client.Reader, host string, cfg operatorConfig) (client.Object, error) {
+
+	ingress, err := hostOwner(ctx, c, host, cfg)
+	if err != nil || ingress != nil {
+		return ingress, err
+	}
+
+	var owner client.Object
+	for _, source := range hostSources {
+		list := source.newList()
+		if err := c.List(ctx, list, client.MatchingFields{sourceHostIndexKey: host}); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		candidates := make([]client.Object, 0, len(items))
+		for _, item := range items {
+			candidates = append(candidates, item.(client.Object))
+		}
+
+		// Generated hostnames depend on the configuration and are not in the cache index
+		if _, templated := source.(templatedSource); templated {
+			generated, err := cfg.objectsGenerating(ctx, c, source.newList(), source.kind(), source.hosts, host)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, generated...)
+		}
+
+		for _, candidate := range candidates {
+			if !candidate.GetDeletionTimestamp().IsZero() || !sourceManages(source, candidate) {
+				continue
+			}
+			if _, found := cfg.providerRef(candidate.GetAnnotations()); !found {
+				continue
+			}
+			if hosts, _ := sourceHosts(source, candidate, cfg); !containsString(hosts, host) {
+				continue
+			}
+			if owner == nil || ownsBefore(candidate, owner) {
+				owner = candidate
+			}
+		}
+	}
+
+	return owner, nil
+}
+
+// sourceKind returns the kind of an object returned by sourceOwner or endpointOwner.
+func sourceKind(obj client.Object) string {
+
+	switch obj.(type) {
+	case *networkingv1.Ingress:
+		return "Ingress"
+	case *dnsv1.DNSEndpoint:
+		return "DNSEndpoint"
+	}
+	for _, source := range hostSources {
+		if isSourceKind(source, obj) {
+			return source.kind()
+		}
+	}
+
+	return ""
+}
+
+// isSourceKind reports whether obj is of the kind of a hostSource. Unstructured objects are
+// compared by their kind, all others by their Go type.
+func isSourceKind(source hostSource, obj client.Object) bool {
+
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.GetKind() == source.kind()
+	}
+
+	return reflect.TypeOf(source.newObject()) == reflect.TypeOf(obj)
+}
+
+// sourceInstalled reports whether the resources of obj's kind are served by the cluster.
+func sourceInstalled(mgr ctrl.Manager, obj client.Object) (bool, error) {
+
+	gvk, err := apiutil.GVKForObject(obj, mgr.GetScheme())
+	if err != nil {
+		return false, err
+	}
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// sourceFilter is implemented by hostSources that only manage some of their objects, e.g.
+// Services of type LoadBalancer.
+type sourceFilter interface {
+	manages(obj client.Object) bool
+}
+
+// sourceManages reports whether a hostSource manages obj.
+func sourceManages(source hostSource, obj client.Object) bool {
+
+	filter, ok := source.(sourceFilter)
+	return !ok || filter.manages(obj)
+}
+
+// templatedSource is implemented by hostSources whose objects get their hostnames from the
+// hostnameTemplates if they declare none.
+type templatedSource interface {
+	templated()
+}
+
+// sourceHosts returns the hostnames of an object of a hostSource: the ones it declares, or
+// the generated ones.
+func sourceHosts(source hostSource, obj client.Object, cfg operatorConfig) ([]string, error) {
+
+	declared := source.hosts(obj)
+	if _, ok := source.(templatedSource); !ok || len(declared) > 0 {
+		return declared, nil
+	}
+
+	return cfg.generatedHosts(obj, source.kind())
+}
+
+// recordSource is implemented by hostSources whose records do not all point to the same
+// targets. records returns the records of an object for the hostnames it owns.
+type recordSource interface {
+	records(ctx context.Context, c client.Reader, obj client.Object, hosts []string, cfg operatorConfig) ([]desiredRecord, error)
+}
+
+// sourceWarner is implemented by hostSources that cannot publish every hostname an object
+// declares. warnings describes what is skipped.
+type sourceWarner interface {
+	warnings(obj client.Object) []string
+}
+
+// sourceReconciler publishes the hostnames of the objects of a hostSource.
+type sourceReconciler struct {
+	client.Client
+	Scheme             *runtime.Scheme
+	ConfigMapName      string
+	ConfigMapNamespace string
+	Recorder           events.EventRecorder
+	NewProvider        ProviderFactory
+	Scope              IngressScope
+
+	source hostSource
+}
+
+// writer returns the recordWriter that publishes the hostnames of the source.
+func (r *sourceReconciler) writer() *recordWriter {
+	return &recordWriter{
+		Client:             r.Client,
+		ConfigMapName:      r.ConfigMapName,
+		ConfigMapNamespace: r.ConfigMapNamespace,
+		Recorder:           r.Recorder,
+		NewProvider:        r.NewProvider,
+		Scope:              r.Scope,
+	}
+}
+
+// Reconcile publishes the hostnames of an object and removes its records when it is deleted.
+func (r *sourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	w := r.writer()
+
+	obj := r.source.newObject()
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get "+r.source.kind())
+		return ctrl.Result{}, err
+	}
+
+	cfg, err := w.loadOperatorConfig(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to load operator configuration")
+		return ctrl.Result{}, err
+	}
+
+	recordSet, err := getRecordSet(ctx, r.Client, r.Scheme, obj)
+	if err != nil {
+		logger.Error(err, "Failed to load DNSRecordSet")
+		return ctrl.Result{}, err
+	}
+	var previous dnsv1.DNSRecordSetStatus
+	if recordSet != nil {
+		previous = recordSet.Status
+	}
+
+	if !obj.GetDeletionTimestamp().IsZero() {
+		if !controllerutil.ContainsFinalizer(obj, cleanupFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		status, err := r.cleanupRecords(ctx, obj, previous, cfg)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if requeue := retryableFailures(status.Failures); len(requeue) > 0 {
+			logger.Info("Cleanup of DNS records failed, retrying", "domains", requeue)
+			return r.saveStatus(ctx, obj, status, nil)
+		}
+
+		controllerutil.RemoveFinalizer(obj, cleanupFinalizer)
+		return ctrl.Result{}, r.Update(ctx, obj)
+	}
+
+	ref, found := cfg.providerRef(obj.GetAnnotations())
+	if !found || !sourceManages(r.source, obj) || r.lacksHosts(obj, cfg) {
+		logger.Info("No DNS configuration annotation found. Skipping...")
+		// Records published before the annotations were removed are cleaned up on deletion
+		if len(previous.Records) == 0 && controllerutil.RemoveFinalizer(obj, cleanupFinalizer) {
+			return ctrl.Result{}, r.Update(ctx, obj)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if controllerutil.AddFinalizer(obj, cleanupFinalizer) {
+		if err := r.Update(ctx, obj); err != nil {
+			logger.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if warner, ok := r.source.(sourceWarner); ok {
+		for _, warning := range warner.warnings(obj) {
+			logger.Info(warning)
+			w.recordEvent(obj, corev1.EventTypeWarning, reasonUnsupportedHost, "%s", warning)
+		}
+	}
+
+	hosts, err := sourceHosts(r.source, obj, cfg)
+	if err != nil {
+		// Records published before are kept until the hostnames can be generated again
+		logger.Error(err, "Failed to generate hostnames")
+		w.recordEvent(obj, corev1.EventTypeWarning, reasonHostnameTemplate, "No hostnames are published: %v", err)
+		return ctrl.Result{}, nil
+	}
+
+	hosts, excluded := w.filterHosts(ctx, obj, hosts)
+	hosts, conflicts, err := r.resolveConflicts(ctx, obj, hosts, cfg)
+	if err != nil {
+		logger.Error(err, "Failed to check for hostname conflicts")
+		return ctrl.Result{}, err
+	}
+
+	provider, err := w.provider(ctx, obj.GetNamespace(), ref, nil)
+	var desired []desiredRecord
+	if err == nil {
+		desired, err = r.desiredRecords(ctx, obj, hosts, cfg)
+	}
+	if err == nil {
+		var recordConflicts []dnsv1.HostConflict
+		desired, recordConflicts, err = r.resolveRecordConflicts(ctx, obj, hosts, desired, cfg)
+		conflicts = append(conflicts, recordConflicts...)
+	}
+
+	// Without a provider or a target no host can be published; keep what was published before
+	if err != nil {
+		logger.Error(err, "Failed to prepare DNS records")
+		status := dnsv1.DNSRecordSetStatus{Records: previous.Records, Conflicts: conflicts}
+		for _, host := range hosts {
+			status.Failures = append(status.Failures, w.hostFailed(obj, previous.Failures, host, err))
+		}
+		return r.saveStatus(ctx, obj, status, excluded)
+	}
+
+	status := w.syncRecords(ctx, obj, provider, desired, previous, conflicts)
+	result, err := r.saveStatus(ctx, obj, status, excluded)
+	if err == nil && result.RequeueAfter == 0 {
+		result.RequeueAfter = cfg.ResyncInterval
+	}
+
+	return result, err
+}
+
+// lacksHosts reports whether an object of a templatedSource neither declares hostnames nor
+// gets any generated, e.g. a Service without dns.configuration/hostname and no template.
+func (r *sourceReconciler) lacksHosts(obj client.Object, cfg operatorConfig) bool {
+
+	if _, ok := r.source.(templatedSource); !ok {
+		return false
+	}
+	hosts, err := sourceHosts(r.source, obj, cfg)
+
+	return err == nil && len(hosts) == 0
+}
+
+// desiredRecords returns the records of the hostnames an object owns.
+func (r *sourceReconciler) desiredRecords(ctx context.Context, obj client.Object, hosts []string, cfg operatorConfig) ([]desiredRecord, error) {
+
+	if source, ok := r.source.(recordSource); ok {
+		return source.records(ctx, r.Client, obj, hosts, cfg)
+	}
+
+	recordType, targets, err := r.source.targets(ctx, r.Client, obj, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return desiredRecords(hosts, recordType, targets), nil
+}
+
+// resolveConflicts splits hostnames into the ones the object owns and the ones another
+// object owns.
+func (r *sourceReconciler) resolveConflicts(ctx context.Context, obj client.Object, hosts []string, cfg operatorConfig) ([]string, []dnsv1.HostConflict, error) {
+
+	owned := []string{}
+	var conflicts []dnsv1.HostConflict
+
+	for _, host := range hosts {
+		owner, err := sourceOwner(ctx, r.Client, host, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if owner == nil || sourceKind(owner) == r.source.kind() && client.ObjectKeyFromObject(owner) == client.ObjectKeyFromObject(obj) {
+			owned = append(owned, host)
+			continue
+		}
+
+		ownerName := client.ObjectKeyFromObject(owner).String()
+		ownerKind := sourceKind(owner)
+		log.FromContext(ctx).Info("Host is published by another object. Skipping...", "domain", host, "kind", ownerKind, "owner", ownerName)
+		r.writer().recordEvent(obj, corev1.EventTypeWarning, reasonHostConflict, "Host %s is already published by %s %s", host, ownerKind, ownerName)
+		conflict := dnsv1.HostConflict{Host: host, Owner: ownerName}
+		if ownerKind != "Ingress" {
+			conflict.Kind = ownerKind
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	return owned, conflicts, nil
+}
+
+// resolveRecordConflicts drops the desired records of hostnames the source generated beyond
+// the declared ones, e.g. the per-pod hosts of headless Services, if another object owns them.
+func (r *sourceReconciler) resolveRecordConflicts(ctx context.Context, obj client.Object, hosts []string, desired []desiredRecord, cfg operatorConfig) ([]desiredRecord, []dnsv1.HostConflict, error) {
+
+	var generated []string
+	for _, record := range desired {
+		if !containsString(hosts, record.host) && !containsString(generated, record.host) {
+			generated = append(generated, record.host)
+		}
+	}
+	if len(generated) == 0 {
+		return desired, nil, nil
+	}
+
+	owned, conflicts, err := r.resolveConflicts(ctx, obj, generated, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kept []desiredRecord
+	for _, record := range desired {
+		if containsString(hosts, record.host) || containsString(owned, record.host) {
+			kept = append(kept, record)
+		}
+	}
+
+	return kept, conflicts, nil
+}
+
+// cleanupRecords removes or releases the records of a deleted object, unless another object
+// takes their hostname over.
+func (r *sourceReconciler) cleanupRecords(ctx context.Context, obj client.Object, previous dnsv1.DNSRecordSetStatus, cfg operatorConfig) (dnsv1.DNSRecordSetStatus, error) {
+	logger := log.FromContext(ctx)
+	w := r.writer().withConfig(cfg)
+
+	policy := deletionPolicy(ctx, obj, cfg)
+	logger.Info("Cleaning up DNS records for deleted "+r.source.kind(), "deletionPolicy", policy)
+
+	var status dnsv1.DNSRecordSetStatus
+	for _, record := range previous.Records {
+		if cfg.excludes(record.Host) {
+			continue
+		}
+
+		owner, err := sourceOwner(ctx, r.Client, record.Host, cfg)
+		if err != nil {
+			return dnsv1.DNSRecordSetStatus{}, err
+		}
+		if owner != nil {
+			logger.Info("Host is taken over by another object", "domain", record.Host, "kind", sourceKind(owner), "owner", client.ObjectKeyFromObject(owner).String())
+			continue
+		}
+
+		if !cfg.deletions.take() {
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, newHostFailure(previous.Failures, record.Host, errDeletionLimit))
+			continue
+		}
+		if err := w.cleanupRecord(ctx, obj, record, policy); err != nil {
+			logger.Error(err, "Failed to clean up DNS records", "domain", record.Host)
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, w.hostFailed(obj, previous.Failures, record.Host, err))
+		}
+	}
+
+	return status, nil
+}
+
+// saveStatus stores the DNSRecordSet status of an object and requeues it if hosts failed.
+func (r *sourceReconciler) saveStatus(ctx context.Context, obj client.Object, status dnsv1.DNSRecordSetStatus, excluded []string) (ctrl.Result, error) {
+
+	status.ObservedGeneration = obj.GetGeneration()
+	summarizeStatus(&status, excluded)
+
+	if err := saveRecordSet(ctx, r.Client, r.Scheme, obj, status); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update DNSRecordSet")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter(status.Failures)}, nil
+}
+
+// objectsSharingHosts maps an Ingress or another source to the objects of the reconciler's
+// kind that declare one of its hostnames, so they step back or take a hostname over.
+func (r *sourceReconciler) objectsSharingHosts(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	cfg, err := r.writer().loadOperatorConfig(ctx)
+	generates := err == nil && cfg.generatesHosts()
+
+	var hosts []string
+	if ingress, ok := obj.(*networkingv1.Ingress); ok {
+		hosts = indexIngressHosts(ingress)
+		if generates {
+			hosts = normalizeHosts(append(hosts, cfg.ingressHostnames(ingress)...))
+		}
+	} else {
+		for _, source := range hostSources {
+			if isSourceKind(source, obj) {
+				hosts = source.hosts(obj)
+				if generates {
+					generated, _ := sourceHosts(source, obj, cfg)
+					hosts = normalizeHosts(append(hosts, generated...))
+				}
+			}
+		}
+	}
+
+	var requests []reconcile.Request
+	if _, templated := r.source.(templatedSource); templated && generates {
+		requests = objectsGeneratingHosts(ctx, r.Client, r.source.newList(), r.source.kind(), r.source.hosts, hosts, obj, cfg)
+	}
+	for _, host := range hosts {
+		list := r.source.newList()
+		if err := r.List(ctx, list, client.MatchingFields{sourceHostIndexKey: host}); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list objects by host", "kind", r.source.kind(), "domain", host)
+			continue
+		}
+		items, _ := meta.ExtractList(list)
+		for _, item := range items {
+			key := client.ObjectKeyFromObject(item.(client.Object))
+			if r.source.kind() != sourceKind(obj) || key != client.ObjectKeyFromObject(obj) {
+				requests = append(requests, reconcile.Request{NamespacedName: key})
+			}
+		}
+	}
+
+	return requests
+}
+
+// builder returns the controller for the reconciler's kind. It watches Ingresses and the
+// other installed sources, so objects take hostnames over from each other. Callers add the
+// watches for their targets.
+func (r *sourceReconciler) builder(mgr ctrl.Manager) (*builder.TypedBuilder[reconcile.Request], error) {
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), r.source.newObject(), sourceHostIndexKey, indexSourceHosts(r.source)); err != nil {
+		return nil, err
+	}
+
+	// Objects the source does not manage are only of interest while their records are cleaned up
+	managed := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return sourceManages(r.source, obj) || controllerutil.ContainsFinalizer(obj, cleanupFinalizer)
+	})
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(r.source.newObject(), builder.WithPredicates(managed)).
+		Owns(&dnsv1.DNSRecordSet{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&networkingv1.Ingress{}, handler.EnqueueRequestsFromMapFunc(r.objectsSharingHosts))
+
+	for _, other := range hostSources {
+		if other == r.source {
+			continue
+		}
+		installed, err := sourceInstalled(mgr, other.newObject())
+		if err != nil {
+			return nil, err
+		}
+		if installed {
+			b = b.Watches(other.newObject(), handler.EnqueueRequestsFromMapFunc(r.objectsSharingHosts))
+		}
+	}
+
+	return b.Named(strings.ToLower(r.source.kind())), nil
+}
@@ -19,6 +19,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -32,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
 	// +kubebuilder:scaffold:imports
@@ -57,6 +59,13 @@ var _ = BeforeSuite(func() {
 
 	ctx, cancel = context.WithCancel(context.TODO())
 
+	err := networkingv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+	err = gatewayv1.Install(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	// +kubebuilder:scaffold:scheme
+
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
@@ -71,17 +80,18 @@ var _ = BeforeSuite(func() {
 			fmt.Sprintf("1.31.0-%s-%s", runtime.GOOS, runtime.GOARCH)),
 	}
 
-	var err error
+	// Most specs use a fake client; only the ones that need an API server are skipped without
+	// the envtest binaries, e.g. when running go test directly instead of make test.
+	if !envtestInstalled(testEnv.BinaryAssetsDirectory) {
+		testEnv = nil
+		return
+	}
+
 	// cfg is defined in this file globally.
 	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
-	err = networkingv1.AddToScheme(scheme.Scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	// +kubebuilder:scaffold:scheme
-
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
@@ -91,6 +101,32 @@ var _ = BeforeSuite(func() {
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
 	cancel()
+	if testEnv == nil {
+		return
+	}
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
+
+// envtestInstalled reports whether the envtest binaries are in KUBEBUILDER_ASSETS, dir or the
+// default path of controller-runtime.
+func envtestInstalled(dir string) bool {
+
+	for _, path := range []string{os.Getenv("KUBEBUILDER_ASSETS"), dir, "/usr/local/kubebuilder/bin"} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "kube-apiserver")); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireEnvtest skips a spec that needs the API server of envtest if it is not running.
+func requireEnvtest() {
+	if k8sClient == nil {
+		Skip("envtest binaries are not installed")
+	}
+}
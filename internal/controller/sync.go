@@ -0,0 +1,333 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	dnsv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+)
+
+// desiredRecord is a record a source should have published.
+type desiredRecord struct {
+	host       string
+	recordType string
+	targets    []string
+}
+
+// desiredRecords returns the records for hosts that all point to the same targets.
+func desiredRecords(hosts []string, recordType string, targets []string) []desiredRecord {
+
+	var desired []desiredRecord
+	for _, host := range hosts {
+		desired = append(desired, desiredRecord{host: host, recordType: recordType, targets: targets})
+	}
+
+	return desired
+}
+
+// syncRecords removes the previous records of obj whose host is no longer desired, see
+// removeRecords, and writes the desired records with provider. Previous records written with
+// another provider, e.g. before the type or source of obj changed, are removed once their
+// host is published with provider, see removeMovedRecords. The returned status holds the
+// records now published and the hosts that failed.
+func (w *recordWriter) syncRecords(ctx context.Context, obj client.Object, provider *resolvedProvider, desired []desiredRecord, previous dnsv1.DNSRecordSetStatus, conflicts []dnsv1.HostConflict) dnsv1.DNSRecordSetStatus {
+	logger := log.FromContext(ctx)
+
+	current := dnsv1.DNSRecordSetStatus{Failures: previous.Failures}
+	var moved []dnsv1.ManagedRecord
+	for _, record := range previous.Records {
+		if w.recordProvider(record) == provider.ref {
+			current.Records = append(current.Records, record)
+		} else {
+			moved = append(moved, record)
+		}
+	}
+
+	status := w.removeRecords(ctx, obj, desired, current, conflicts)
+	status.Conflicts = conflicts
+
+	// Add records; dual-stack hosts have an A and an AAAA record
+	var hosts []string
+	for _, record := range desired {
+		domain := record.host
+		target := strings.Join(record.targets, ",")
+		previousRecord, published := findTypedRecord(current.Records, domain, record.recordType)
+		if !containsString(hosts, domain) {
+			hosts = append(hosts, domain)
+		}
+
+		if limit := w.cfg.Limits.MaxHostsPerSource; limit > 0 && len(hosts) > int(limit) {
+			if published {
+				status.Records = append(status.Records, previousRecord)
+			}
+			status.Failures = w.addFailure(status.Failures, obj, previous.Failures, domain, permanent(fmt.Errorf("more than %d hosts are declared", limit)))
+			continue
+		}
+		if err := provider.checkHost(domain); err != nil {
+			// Records published before the zones or a DNSZonePolicy changed stay tracked
+			if published {
+				status.Records = append(status.Records, previousRecord)
+			}
+			status.Failures = w.addFailure(status.Failures, obj, previous.Failures, domain, err)
+			continue
+		}
+		ids, changed, err := w.ensureRecords(ctx, obj, provider, domain, record.recordType, record.targets)
+		if err != nil {
+			if err == errRecordNotOwned {
+				logger.Info("DNS record exists but is not managed by kube-dns-manager. Skipping...", "domain", domain)
+				w.recordEvent(obj, corev1.EventTypeWarning, reasonRecordNotOwned, "%s record %s exists but is not owned by kube-dns-manager", record.recordType, domain)
+				if published {
+					status.Records = append(status.Records, previousRecord)
+				}
+				if !hasFailed(status.Failures, domain) {
+					status.Failures = append(status.Failures, newHostFailure(previous.Failures, domain, permanent(err)))
+				}
+				continue
+			}
+			logger.Error(err, "Failed to create or update DNS records", "domain", domain)
+			if published {
+				status.Records = append(status.Records, previousRecord)
+			}
+			status.Failures = w.addFailure(status.Failures, obj, previous.Failures, domain, err)
+			continue
+		}
+		// Records that had to be written although their target did not change were changed by someone else
+		if published && changed && previousRecord.Target == target {
+			logger.Info("Repaired DNS records that were changed outside kube-dns-manager", "domain", domain)
+			driftRepairs.WithLabelValues(provider.ptype, provider.Zone()).Inc()
+		}
+		status.Records = append(status.Records, provider.managedRecord(domain, record.recordType, target, ids))
+	}
+
+	if len(status.Failures) == 0 {
+		lastSuccessfulSync.WithLabelValues(provider.Zone()).SetToCurrentTime()
+	}
+
+	return w.removeMovedRecords(ctx, obj, moved, desired, status, previous.Failures)
+}
+
+// removeMovedRecords removes records of obj that were written with a provider it no longer
+// uses. The record of a desired host is kept until status has its record from the new
+// provider, so the host keeps resolving while it moves. If the new provider wrote the same
+// record, e.g. with other credentials for the zone, it is only no longer tracked. The returned
+// status adds the records that are kept to status.
+func (w *recordWriter) removeMovedRecords(ctx context.Context, obj client.Object, moved []dnsv1.ManagedRecord, desired []desiredRecord, status dnsv1.DNSRecordSetStatus, previousFailures []dnsv1.HostFailure) dnsv1.DNSRecordSetStatus {
+	logger := log.FromContext(ctx)
+
+	stale := dnsv1.DNSRecordSetStatus{Failures: previousFailures}
+	for _, record := range moved {
+		_, found := findRecord(status.Records, record.Host)
+		switch {
+		case publishedAt(status.Records, record):
+			continue
+		case !found && isDesired(desired, record.Host):
+			ref := w.recordProvider(record)
+			logger.Info("Keeping DNS records at the previous provider until the host is published", "domain", record.Host, "provider", refName(ref))
+			status.Records = append(status.Records, record)
+			// The failure shows the move as stuck until the new provider publishes the host
+			failure := newHostFailure(providerFailures(previousFailures, bindingName(ref)), record.Host, fmt.Errorf("records are kept at %s until the host is published with the new provider", refName(ref)))
+			failure.Provider = bindingName(ref)
+			status.Failures = append(status.Failures, failure)
+			continue
+		}
+		stale.Records = append(stale.Records, record)
+	}
+
+	removed := w.removeRecords(ctx, obj, nil, stale, status.Conflicts)
+	status.Records = append(status.Records, removed.Records...)
+	status.Failures = append(status.Failures, removed.Failures...)
+
+	return status
+}
+
+// addFailure adds a failure of host to failures and reports it with an event on obj. A host
+// with an A and an AAAA record only fails once.
+func (w *recordWriter) addFailure(failures []dnsv1.HostFailure, obj client.Object, previous []dnsv1.HostFailure, host string, err error) []dnsv1.HostFailure {
+
+	if hasFailed(failures, host) {
+		return failures
+	}
+
+	return append(failures, w.hostFailed(obj, previous, host, err))
+}
+
+// hasFailed reports whether failures hold a failure of host.
+func hasFailed(failures []dnsv1.HostFailure, host string) bool {
+
+	for _, failure := range failures {
+		if failure.Host == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// providerFailures returns the failures tracked for a provider.
+func providerFailures(failures []dnsv1.HostFailure, provider string) []dnsv1.HostFailure {
+
+	var matching []dnsv1.HostFailure
+	for _, failure := range failures {
+		if failure.Provider == provider {
+			matching = append(matching, failure)
+		}
+	}
+
+	return matching
+}
+
+// publishedAt reports whether records hold a record of the host of record at its location.
+// With several provider bindings a host has a record for each of them, so all are checked.
+func publishedAt(records []dnsv1.ManagedRecord, record dnsv1.ManagedRecord) bool {
+
+	for _, published := range records {
+		if published.Host == record.Host && published.Type == record.Type && sameLocation(published, record) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameLocation reports whether two records of a host are the same DNS record, written with
+// the same type of provider to the same zone. Records from before the zone was recorded are
+// assumed to be, so they are never removed behind the back of the new provider.
+func sameLocation(record, other dnsv1.ManagedRecord) bool {
+	return record.Provider == other.Provider && (record.Zone == other.Zone || record.Zone == "" || other.Zone == "")
+}
+
+// removeRecords removes the previous records of obj whose host and type are no longer desired. Records
+// of excluded hosts are no longer managed and the ones of conflicts are taken over by their
+// new owner, so both are left alone. The returned status holds the records that are kept
+// because their removal failed or is postponed, and why.
+func (w *recordWriter) removeRecords(ctx context.Context, obj client.Object, desired []desiredRecord, previous dnsv1.DNSRecordSetStatus, conflicts []dnsv1.HostConflict) dnsv1.DNSRecordSetStatus {
+	logger := log.FromContext(ctx)
+
+	var status dnsv1.DNSRecordSetStatus
+
+	for _, record := range previous.Records {
+		if isDesiredRecord(desired, record) {
+			continue
+		}
+		if w.cfg.excludes(record.Host) {
+			logger.Info("Domain excluded, no longer managing its records", "domain", record.Host)
+			continue
+		}
+		if hasConflict(conflicts, record.Host) {
+			// The new owner takes the records over
+			continue
+		}
+		if !w.cfg.deletions.take() {
+			logger.Info("Deletion limit reached, keeping DNS records until the next reconcile", "domain", record.Host)
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, newHostFailure(previous.Failures, record.Host, errDeletionLimit))
+			continue
+		}
+		if err := w.removeRecord(ctx, obj, record); err != nil {
+			logger.Error(err, "Failed to delete DNS records", "domain", record.Host)
+			status.Records = append(status.Records, record)
+			status.Failures = append(status.Failures, w.hostFailed(obj, previous.Failures, record.Host, err))
+		}
+	}
+
+	return status
+}
+
+// isDesired reports whether one of the desired records is for host.
+func isDesired(desired []desiredRecord, host string) bool {
+
+	for _, record := range desired {
+		if record.host == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDesiredRecord reports whether one of the desired records is for the host and type of record.
+func isDesiredRecord(desired []desiredRecord, record dnsv1.ManagedRecord) bool {
+
+	for _, desiredRecord := range desired {
+		if desiredRecord.host == record.Host && desiredRecord.recordType == record.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterHosts drops the hosts the operator configuration excludes and reports them with an
+// event on obj. It returns the remaining and the excluded hosts.
+func (w *recordWriter) filterHosts(ctx context.Context, obj client.Object, hosts []string) ([]string, []string) {
+	logger := log.FromContext(ctx)
+
+	filtered := []string{}
+	var excluded []string
+	for _, host := range hosts {
+		if !w.cfg.excludes(host) {
+			filtered = append(filtered, host)
+			continue
+		}
+		logger.Info("Domain excluded from processing", "domain", host)
+		w.recordEvent(obj, corev1.EventTypeNormal, reasonDomainExcluded, "Host %s is excluded by the operator configuration, no DNS records are published", host)
+		excluded = append(excluded, host)
+	}
+
+	return filtered, excluded
+}
+
+// deletionPolicy returns the policy of an object, falling back to the global default. Unknown
+// annotation values retain the records, since deleting is the action that cannot be undone.
+func deletionPolicy(ctx context.Context, obj client.Object, cfg operatorConfig) string {
+
+	value, found := obj.GetAnnotations()[deletionPolicyAnnotation]
+	if !found {
+		return cfg.DeletionPolicy
+	}
+
+	switch value {
+	case DeletionPolicyDelete, DeletionPolicyRetain:
+		return value
+	default:
+		log.FromContext(ctx).Info("Unknown deletion policy, retaining records", "deletionPolicy", value)
+		return DeletionPolicyRetain
+	}
+}
+
+// cleanupRecord removes or releases the records of one host of a deleted object with the
+// deletion policy.
+func (w *recordWriter) cleanupRecord(ctx context.Context, obj client.Object, record dnsv1.ManagedRecord, policy string) error {
+
+	if policy == DeletionPolicyRetain {
+		// Keep the A record, but release it so another owner can adopt it.
+		provider, err := w.provider(ctx, obj.GetNamespace(), w.recordProvider(record), nil)
+		if err != nil {
+			return err
+		}
+		return w.releaseRecords(ctx, obj, provider, record.Host)
+	}
+
+	return w.removeRecord(ctx, obj, record)
+}
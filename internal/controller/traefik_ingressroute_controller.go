@@ -0,0 +1,184 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// +kubebuilder:rbac:groups=traefik.io,resources=ingressroutes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=traefik.io,resources=ingressroutes/finalizers,verbs=update
+
+// ingressRouteGVK is the Traefik IngressRoute. Its types are not compiled in, the objects are
+// read as unstructured.
+var ingressRouteGVK = schema.GroupVersionKind{Group: "traefik.io", Version: "v1alpha1", Kind: "IngressRoute"}
+
+var (
+	// hostMatcher finds Host(...) matchers of a Traefik rule; HostRegexp, HostHeader and
+	// HostSNI do not match.
+	hostMatcher = regexp.MustCompile("\\bHost\\(([^)]*)\\)")
+	// hostRegexpMatcher finds HostRegexp(...) matchers, which cannot be published.
+	hostRegexpMatcher = regexp.MustCompile("\\bHostRegexp\\(")
+	// ruleArgument finds the quoted arguments of a matcher.
+	ruleArgument = regexp.MustCompile("`([^`]*)`|\"([^\"]*)\"")
+)
+
+// TraefikIngressRouteReconciler publishes the hostnames of the Host matchers of Traefik
+// IngressRoutes. Like the ones of Ingresses, the records point to the target services or nodes.
+type TraefikIngressRouteReconciler struct {
+	client.Client
+	Scheme             *runtime.Scheme
+	ConfigMapName      string
+	ConfigMapNamespace string
+	Recorder           events.EventRecorder
+
+	NewProvider ProviderFactory
+
+	// Scope is the scope of the IngressReconciler. Ingresses outside it own no hostnames.
+	Scope IngressScope
+}
+
+// traefikRouteSource is the hostSource of Traefik IngressRoutes.
+type traefikRouteSource struct{}
+
+var ingressRouteSource = &traefikRouteSource{}
+
+func (s *traefikRouteSource) kind() string { return ingressRouteGVK.Kind }
+
+func (s *traefikRouteSource) newObject() client.Object {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(ingressRouteGVK)
+	return obj
+}
+
+func (s *traefikRouteSource) newList() client.ObjectList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(ingressRouteGVK.GroupVersion().WithKind(ingressRouteGVK.Kind + "List"))
+	return list
+}
+
+// hosts returns the hostnames of the Host matchers in the match rules of an IngressRoute.
+func (s *traefikRouteSource) hosts(obj client.Object) []string {
+
+	var hosts []string
+	for _, match := range ingressRouteMatches(obj) {
+		hosts = append(hosts, ruleHosts(match)...)
+	}
+
+	return normalizeHosts(hosts)
+}
+
+// warnings reports the routes whose hostnames are matched with HostRegexp.
+func (s *traefikRouteSource) warnings(obj client.Object) []string {
+
+	var warnings []string
+	for _, match := range ingressRouteMatches(obj) {
+		if hostRegexpMatcher.MatchString(match) {
+			warnings = append(warnings, fmt.Sprintf("HostRegexp matchers are not published: %s", match))
+		}
+	}
+
+	return warnings
+}
+
+// targets returns the addresses Ingresses use.
+func (s *traefikRouteSource) targets(ctx context.Context, c client.Reader, obj client.Object, cfg operatorConfig) (string, []string, error) {
+	return ingressTargets(ctx, c, cfg)
+}
+
+// ingressRouteMatches returns the match rules of the routes of an IngressRoute.
+func ingressRouteMatches(obj client.Object) []string {
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	routes, _, _ := unstructured.NestedSlice(u.Object, "spec", "routes")
+
+	var matches []string
+	for _, route := range routes {
+		fields, ok := route.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if match, ok := fields["match"].(string); ok && match != "" {
+			matches = append(matches, match)
+		}
+	}
+
+	return matches
+}
+
+// ruleHosts returns the arguments of the Host matchers of a Traefik rule, e.g. a.example.com
+// and b.example.com for "Host(`a.example.com`, `b.example.com`) && PathPrefix(`/api`)".
+func ruleHosts(rule string) []string {
+
+	var hosts []string
+	for _, matcher := range hostMatcher.FindAllStringSubmatch(rule, -1) {
+		for _, argument := range ruleArgument.FindAllStringSubmatch(matcher[1], -1) {
+			host := argument[1] + argument[2]
+			if host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	return hosts
+}
+
+// SetupWithManager sets up the controller if the IngressRoute resources are installed.
+func (r *TraefikIngressRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	installed, err := sourceInstalled(mgr, ingressRouteSource.newObject())
+	if err != nil {
+		return err
+	}
+	if !installed {
+		mgr.GetLogger().WithName("traefik").Info("Traefik IngressRoute resources not installed, not watching them")
+		return nil
+	}
+
+	reconciler := &sourceReconciler{
+		Client:             r.Client,
+		Scheme:             r.Scheme,
+		ConfigMapName:      r.ConfigMapName,
+		ConfigMapNamespace: r.ConfigMapNamespace,
+		Recorder:           r.Recorder,
+		NewProvider:        r.NewProvider,
+		Scope:              r.Scope,
+		source:             ingressRouteSource,
+	}
+	b, err := reconciler.builder(mgr)
+	if err != nil {
+		return err
+	}
+
+	return b.Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(reconciler.objectsForNode), builder.WithPredicates(nodeTargetChanged)).
+		Complete(reconciler)
+}
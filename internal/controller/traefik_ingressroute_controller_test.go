@@ -0,0 +1,132 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	k8snetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/ruedigerp/kube-dns-manager/api/v1"
+	"github.com/ruedigerp/kube-dns-manager/dnsapi"
+)
+
+var _ = Describe("Traefik IngressRoutes", func() {
+	const namespace = "shop"
+
+	ctx := context.Background()
+
+	var (
+		provider   *fakeProvider
+		recorder   *events.FakeRecorder
+		reconciler *sourceReconciler
+		route      *unstructured.Unstructured
+		objects    []client.Object
+	)
+
+	newIngressRoute := func(name string, matches ...string) *unstructured.Unstructured {
+		var routes []interface{}
+		for _, match := range matches {
+			routes = append(routes, map[string]interface{}{"kind": "Rule", "match": match})
+		}
+		route := ingressRouteSource.newObject().(*unstructured.Unstructured)
+		route.SetName(name)
+		route.SetNamespace(namespace)
+		route.SetAnnotations(map[string]string{
+			typeAnnotationKey:   dnsapi.ProviderCloudflare,
+			sourceAnnotationKey: "cloudflare-config",
+		})
+		Expect(unstructured.SetNestedSlice(route.Object, routes, "spec", "routes")).To(Succeed())
+		return route
+	}
+
+	reconcileRoute := func(route *unstructured.Unstructured) {
+		if reconciler == nil {
+			reconciler = newTestSourceReconciler(ingressRouteSource, "kube-system", provider, append(objects, route)...)
+			reconciler.Recorder = recorder
+		}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(route)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		provider = &fakeProvider{}
+		recorder = events.NewFakeRecorder(20)
+		reconciler = nil
+		route = newIngressRoute("web",
+			"Host(`shop.example.com`, `www.example.com`) && PathPrefix(`/`)",
+			"HostRegexp(`^.+\\.example\\.com$`)",
+		)
+		objects = []client.Object{
+			loadBalancer("traefik", "192.0.2.10"),
+			cloudflareSource("cloudflare-config", "kube-system"),
+		}
+	})
+
+	It("should parse the hostnames of Host matchers", func() {
+		Expect(ruleHosts("Host(`a.example.com`)")).To(Equal([]string{"a.example.com"}))
+		Expect(ruleHosts("Host(`a.example.com`,`b.example.com`) || (Host(\"c.example.com\") && Path(`/c`))")).
+			To(Equal([]string{"a.example.com", "b.example.com", "c.example.com"}))
+		Expect(ruleHosts("HostRegexp(`{sub:[a-z]+}.example.com`) || HostSNI(`d.example.com`) || HostHeader(`e.example.com`)")).To(BeEmpty())
+
+		Expect(ingressRouteSource.hosts(route)).To(Equal([]string{"shop.example.com", "www.example.com"}))
+		Expect(ingressRouteSource.warnings(route)).To(HaveLen(1))
+	})
+
+	It("should publish the hostnames with the Traefik address", func() {
+		reconcileRoute(route)
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(provider.content("www.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning UnsupportedHost HostRegexp matchers are not published")))
+
+		var recordSet networkingv1.DNSRecordSet
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: "ingressroute-web", Namespace: namespace}, &recordSet)).To(Succeed())
+		Expect(recordSet.Spec.SourceRef.Kind).To(Equal("IngressRoute"))
+		Expect(recordSet.Status.Records).To(HaveLen(2))
+
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(route), route)).To(Succeed())
+		Expect(route.GetFinalizers()).To(ContainElement(cleanupFinalizer))
+	})
+
+	It("should leave hostnames to Ingresses", func() {
+		objects = append(objects, &k8snetworkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other", Annotations: route.GetAnnotations()},
+			Spec:       k8snetworkingv1.IngressSpec{Rules: []k8snetworkingv1.IngressRule{{Host: "www.example.com"}}},
+		})
+		reconcileRoute(route)
+
+		Expect(provider.content("shop.example.com", "A")).To(ConsistOf("192.0.2.10"))
+		Expect(provider.content("www.example.com", "A")).To(BeEmpty())
+	})
+
+	It("should remove the records when the IngressRoute is deleted", func() {
+		reconcileRoute(route)
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(route), route)).To(Succeed())
+		Expect(reconciler.Delete(ctx, route)).To(Succeed())
+		reconcileRoute(route)
+
+		Expect(provider.records).To(BeEmpty())
+	})
+})
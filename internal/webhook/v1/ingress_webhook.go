@@ -0,0 +1,67 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/ruedigerp/kube-dns-manager/internal/controller"
+)
+
+var ingresslog = logf.Log.WithName("ingress-resource")
+
+// SetupIngressWebhookWithManager registers the webhook for Ingress in the manager.
+func SetupIngressWebhookWithManager(mgr ctrl.Manager, validator *controller.IngressValidator) error {
+	return ctrl.NewWebhookManagedBy(mgr, &networkingv1.Ingress{}).
+		WithValidator(&IngressCustomValidator{validator: validator}).
+		Complete()
+}
+
+// Ingresses are validated with failurePolicy=ignore, so an unavailable operator does not block
+// Ingresses of the whole cluster.
+// +kubebuilder:webhook:path=/validate-networking-k8s-io-v1-ingress,mutating=false,failurePolicy=ignore,sideEffects=None,groups=networking.k8s.io,resources=ingresses,verbs=create;update,versions=v1,name=vingress-v1.kb.io,admissionReviewVersions=v1
+
+// IngressCustomValidator rejects Ingresses whose DNS annotations kube-dns-manager cannot use.
+type IngressCustomValidator struct {
+	validator *controller.IngressValidator
+}
+
+var _ admission.Validator[*networkingv1.Ingress] = &IngressCustomValidator{}
+
+// ValidateCreate implements admission.Validator so a webhook will be registered for the type Ingress.
+func (v *IngressCustomValidator) ValidateCreate(ctx context.Context, ingress *networkingv1.Ingress) (admission.Warnings, error) {
+	ingresslog.Info("Validation for Ingress upon creation", "name", ingress.GetName())
+
+	return v.validator.ValidateIngress(ctx, ingress)
+}
+
+// ValidateUpdate implements admission.Validator so a webhook will be registered for the type Ingress.
+func (v *IngressCustomValidator) ValidateUpdate(ctx context.Context, oldIngress, ingress *networkingv1.Ingress) (admission.Warnings, error) {
+	ingresslog.Info("Validation for Ingress upon update", "name", ingress.GetName())
+
+	return v.validator.ValidateIngressUpdate(ctx, oldIngress, ingress)
+}
+
+// ValidateDelete implements admission.Validator so a webhook will be registered for the type Ingress.
+func (v *IngressCustomValidator) ValidateDelete(ctx context.Context, ingress *networkingv1.Ingress) (admission.Warnings, error) {
+	return nil, nil
+}